@@ -0,0 +1,49 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+func TestBuildImage(t *testing.T) {
+	if os.Getenv("DOCKER_HOST") == "" {
+		t.Skip("DOCKER_HOST is not set")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\nCOPY . .\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	saved := buildLog.w
+	buildLog.w = &out
+	defer func() { buildLog.w = saved }()
+
+	const name = "intern-container-basic-image-release-test:integration"
+	if err := buildImage(context.Background(), dir, name); err != nil {
+		t.Fatalf("buildImage: %v\n%s", err, out.String())
+	}
+	if out.Len() == 0 {
+		t.Error("buildImage streamed no build output")
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _, err := cli.ImageRemove(context.Background(), name, types.ImageRemoveOptions{Force: true}); err != nil {
+		t.Logf("remove %s: %v", name, err)
+	}
+}
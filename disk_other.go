@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"log/slog"
+	"runtime"
+)
+
+func PreflightDiskCheck(workDir string, requiredMB int64) error {
+	slog.Warn("disk space pre-flight check is only supported on linux and macOS", "os", runtime.GOOS, "requiredMB", requiredMB)
+	return nil
+}
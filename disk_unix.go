@@ -0,0 +1,20 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+func PreflightDiskCheck(workDir string, requiredMB int64) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(workDir, &stat); err != nil {
+		return fmt.Errorf("statfs %s: %w", workDir, err)
+	}
+	availableMB := int64(stat.Bavail) * int64(stat.Bsize) >> 20
+	if availableMB < requiredMB {
+		return fmt.Errorf("not enough disk space in %s: %d MiB free, %d MiB required", workDir, availableMB, requiredMB)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+func ExecCommand(Dir, Command string) (string, error) {
+	slog.Debug("exec", "dir", Dir, "command", Command)
+	cmd := shellCommand(context.Background(), Command)
+	cmd.Dir = Dir
+	out, err := cmd.Output()
+	if err != nil {
+		return string(out), fmt.Errorf("%s: %w", Command, err)
+	}
+	return string(out), nil
+}
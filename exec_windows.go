@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import (
+	"context"
+	"os/exec"
+)
+
+func shellCommand(ctx context.Context, Command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", Command)
+}
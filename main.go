@@ -1,82 +1,688 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
+	"embed"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
+	"log/slog"
+	mathrand "math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
 
 	"bufio"
 	"crypto/rand"
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/versions"
 	"github.com/docker/docker/client"
-	"github.com/gocolly/colly"
-	"github.com/gocolly/colly/debug"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/buildkit/session"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/net/html"
+	"golang.org/x/term"
+	"golang.org/x/time/rate"
 )
 
 type Downloader struct {
 	io.Reader
-	Total   int64
-	Current int64
+	Total    int64
+	Current  int64
+	Progress *ProgressWriter
 }
 
 func (d *Downloader) Read(p []byte) (n int, err error) {
 	n, err = d.Reader.Read(p)
 	d.Current += int64(n)
-	fmt.Printf("\r正在下载，下载进度：%.2f%%", float64(d.Current*10000/d.Total)/100)
-	if d.Current == d.Total {
-		fmt.Printf("\r下载完成，下载进度：%.2f%%\n", float64(d.Current*10000/d.Total)/100)
+	if d.Progress != nil {
+		d.Progress.Set(d.Current, d.Total)
 	}
 	return
 }
 
-func downloadFile(url, filePath string) {
-	defer wg.Done()
-	resp, err := http.Get(url)
+type ProgressWriter struct {
+	Label       string
+	Current     int64
+	Total       int64
+	MinInterval time.Duration
+	tty         bool
+	lastStep    int64
+	lastPrint   time.Time
+	done        bool
+}
+
+func NewProgressWriter(label string, total int64) *ProgressWriter {
+	return &ProgressWriter{
+		Label:    label,
+		Total:    total,
+		tty:      term.IsTerminal(int(os.Stdout.Fd())),
+		lastStep: -1,
+	}
+}
+
+func (p *ProgressWriter) Write(b []byte) (int, error) {
+	p.Set(p.Current+int64(len(b)), p.Total)
+	return len(b), nil
+}
+
+func (p *ProgressWriter) Set(current, total int64) {
+	p.Current, p.Total = current, total
+	if p.done || p.Total <= 0 {
+		return
+	}
+	percent := float64(p.Current*10000/p.Total) / 100
+	if p.tty {
+		if p.Current < p.Total && time.Since(p.lastPrint) < p.MinInterval {
+			return
+		}
+		p.lastPrint = time.Now()
+		fmt.Printf("\r%s，进度：%.2f%%", p.Label, percent)
+		if p.Current >= p.Total {
+			fmt.Println()
+		}
+	} else if step := p.Current * 10 / p.Total; step > p.lastStep {
+		p.lastStep = step
+		slog.Info(p.Label, "progress", fmt.Sprintf("%.0f%%", percent))
+	}
+	p.done = p.Current >= p.Total
+}
+
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	Multiplier   float64
+}
+
+var downloadRetry = RetryPolicy{
+	MaxAttempts:  5,
+	InitialDelay: 2 * time.Second,
+	Multiplier:   2,
+}
+
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("GET %s: unexpected status %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *HTTPStatusError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+type DownloadError struct {
+	URL     string
+	Attempt int
+	Cause   error
+}
+
+func (e *DownloadError) Error() string {
+	return fmt.Sprintf("download %s (attempt %d): %v", e.URL, e.Attempt, e.Cause)
+}
+
+func (e *DownloadError) Unwrap() error { return e.Cause }
+
+type Sha256MismatchError struct {
+	File     string
+	Expected string
+	Got      string
+}
+
+func (e *Sha256MismatchError) Error() string {
+	return fmt.Sprintf("sha256 mismatch for %s: expected %s, got %s", e.File, e.Expected, e.Got)
+}
+
+type BuildError struct {
+	Version string
+	Arch    string
+	Cause   error
+}
+
+func (e *BuildError) Error() string {
+	return fmt.Sprintf("build %s/%s: %v", e.Version, e.Arch, e.Cause)
+}
+
+func (e *BuildError) Unwrap() error { return e.Cause }
+
+type PushError struct {
+	Image string
+	Tag   string
+	Cause error
+}
+
+func (e *PushError) Error() string {
+	return fmt.Sprintf("push %s:%s: %v", e.Image, e.Tag, e.Cause)
+}
+
+func (e *PushError) Unwrap() error { return e.Cause }
+
+func errorHint(err error) string {
+	var shaErr *Sha256MismatchError
+	var downloadErr *DownloadError
+	var buildErr *BuildError
+	var pushErr *PushError
+	switch {
+	case errors.As(err, &shaErr):
+		return "SHA256 mismatch — delete " + shaErr.File + " and retry"
+	case errors.As(err, &downloadErr):
+		return "download failed — check network access to " + downloadErr.URL + " or use --mirror-url"
+	case errors.As(err, &pushErr):
+		return "push failed — check the registry credentials (DOCKERHUB_USER/DOCKERHUB_PASSWORD or docker login)"
+	case errors.As(err, &buildErr):
+		return "build failed — rerun with --log-level debug to see the daemon output"
+	}
+	return ""
+}
+
+func downloadFile(ctx context.Context, url, filePath string) error {
+	tmpPath := filePath + ".tmp"
+	delay := downloadRetry.InitialDelay
+	for attempt := 1; ; attempt++ {
+		err := fetchFile(ctx, url, tmpPath)
+		if err == nil {
+			return os.Rename(tmpPath, filePath)
+		}
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) && !statusErr.Temporary() {
+			return &DownloadError{URL: url, Attempt: attempt, Cause: err}
+		}
+		if attempt >= downloadRetry.MaxAttempts {
+			return &DownloadError{URL: url, Attempt: attempt, Cause: err}
+		}
+		slog.Warn("download failed, retrying", "url", url, "attempt", attempt, "maxAttempts", downloadRetry.MaxAttempts, "delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = time.Duration(float64(delay) * downloadRetry.Multiplier)
+	}
+}
+
+func fetchFile(ctx context.Context, url, filePath string) error {
+	var offset int64
+	if info, err := os.Stat(filePath); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := mirrorHTTPClient(0).Do(req)
 	if err != nil {
-		log.Fatalln(err)
+		return err
 	}
 	defer func() {
 		_ = resp.Body.Close()
 	}()
-	file, err := os.Create(filePath)
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		flag = os.O_WRONLY | os.O_APPEND
+		slog.Info("resuming download", "path", filePath, "offset", offset)
+	case http.StatusOK:
+		offset = 0
+	case http.StatusRequestedRangeNotSatisfiable:
+		if err := os.Remove(filePath); err != nil {
+			return err
+		}
+		return fetchFile(ctx, url, filePath)
+	default:
+		return &HTTPStatusError{URL: url, StatusCode: resp.StatusCode}
+	}
+	file, err := os.OpenFile(filePath, flag, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer func() {
 		_ = file.Close()
 	}()
+	var body io.Reader = resp.Body
+	if downloadLimiter != nil {
+		body = &RateLimitedReader{Reader: resp.Body, Limiter: downloadLimiter, Ctx: ctx}
+	}
 	downloader := &Downloader{
-		Reader: resp.Body,
-		Total:  resp.ContentLength,
+		Reader:   body,
+		Total:    offset + resp.ContentLength,
+		Current:  offset,
+		Progress: NewProgressWriter("正在下载 "+strings.TrimSuffix(filepath.Base(filePath), ".tmp"), offset+resp.ContentLength),
+	}
+	if downloadLimiter != nil {
+		downloader.Progress.MinInterval = time.Second
+	}
+	_, err = io.Copy(file, downloader)
+	return err
+}
+
+type RateLimitedReader struct {
+	io.Reader
+	Limiter *rate.Limiter
+	Ctx     context.Context
+}
+
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.Limiter.Burst() {
+		p = p[:r.Limiter.Burst()]
 	}
-	if _, err := io.Copy(file, downloader); err != nil {
-		log.Fatalln(err)
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		if waitErr := r.Limiter.WaitN(r.Ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+var downloadLimiter *rate.Limiter
+
+const staleTempAge = 24 * time.Hour
+
+func RemoveStaleTempFiles(root string, maxAge time.Duration) error {
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(p, ".tmp") || time.Since(info.ModTime()) < maxAge {
+			return nil
+		}
+		slog.Info("removing stale partial download", "path", p, "modified", info.ModTime())
+		return os.Remove(p)
+	})
+	if os.IsNotExist(err) {
+		return nil
 	}
+	return err
 }
 
 var wg sync.WaitGroup
 
+func PartialDownloads(root string) ([]string, error) {
+	var partials []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && strings.HasSuffix(p, ".tmp") {
+			partials = append(partials, p)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return partials, err
+}
+
+type InterruptError struct {
+	Signal os.Signal
+}
+
+func (e *InterruptError) Error() string {
+	return "received " + e.Signal.String()
+}
+
+func (e *InterruptError) ExitCode() int {
+	if e.Signal == syscall.SIGTERM {
+		return 143
+	}
+	return 130
+}
+
+func gracefulShutdown(ctx context.Context) {
+	partials, err := PartialDownloads(filepath.Join(config.WorkDir, "openEuler"))
+	if err != nil {
+		slog.Warn("list partial downloads", "err", err)
+	}
+	for _, p := range partials {
+		slog.Info("keeping partial download for resume", "path", p)
+	}
+	slog.Warn("interrupted, in-flight work stopped", "reason", context.Cause(ctx), "partialDownloads", len(partials))
+	finish(true)
+	code := 130
+	var interrupt *InterruptError
+	if errors.As(context.Cause(ctx), &interrupt) {
+		code = interrupt.ExitCode()
+	}
+	os.Exit(code)
+}
+
+var sharedTransport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   10,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ResponseHeaderTimeout: 60 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+var httpTransport http.RoundTripper = sharedTransport
+
+func httpClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: httpTransport,
+	}
+}
+
+type basicAuthTransport struct {
+	Host     string
+	User     string
+	Password string
+	Base     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == t.Host {
+		req = req.Clone(req.Context())
+		req.SetBasicAuth(t.User, t.Password)
+	}
+	return t.Base.RoundTrip(req)
+}
+
+func AuthenticatedHTTPClient(host, user, password string) *http.Client {
+	return &http.Client{
+		Transport: &basicAuthTransport{Host: host, User: user, Password: password, Base: httpTransport},
+	}
+}
+
+func mirrorHTTPClient(timeout time.Duration) *http.Client {
+	if *mirrorUser == "" && *mirrorPassword == "" {
+		return httpClient(timeout)
+	}
+	mirror, err := url.Parse(config.SourceBaseURL)
+	if err != nil {
+		slog.Warn("parse mirror URL, sending requests without credentials", "url", config.SourceBaseURL, "err", err)
+		return httpClient(timeout)
+	}
+	client := AuthenticatedHTTPClient(mirror.Host, *mirrorUser, *mirrorPassword)
+	client.Timeout = timeout
+	return client
+}
+
+func requestTimeout() time.Duration {
+	timeout, err := time.ParseDuration(config.HTTPTimeout)
+	if err != nil {
+		return 30 * time.Second
+	}
+	return timeout
+}
+
+type Config struct {
+	RegistryUser        string       `json:"registryUser"`
+	RegistryPassword    string       `json:"registryPassword"`
+	SourceBaseURL       string       `json:"sourceBaseURL"`
+	TargetRepository    string       `json:"targetRepository"`
+	Architectures       []string     `json:"architectures"`
+	WorkDir             string       `json:"workDir"`
+	DownloadConcurrency int          `json:"downloadConcurrency"`
+	RegistryType        string       `json:"registryType"`
+	RegistryURL         string       `json:"registryURL"`
+	StateFile           string       `json:"stateFile"`
+	DownloadCacheFile   string       `json:"downloadCache"`
+	TagCacheTTL         string       `json:"tagCacheTTL"`
+	ReleasesAPIURL      string       `json:"releasesAPIURL"`
+	HTTPTimeout         string       `json:"httpTimeout"`
+	AliyunRepository    string       `json:"aliyunRepository"`
+	SigningKeyFile      string       `json:"signingKeyFile"`
+	ScrapeParallelism   int          `json:"scrapeParallelism"`
+	ScrapeDelay         string       `json:"scrapeDelay"`
+	AvgArchiveSizeMB    int64        `json:"avgArchiveSizeMB"`
+	DockerfilePath      string       `json:"dockerfile"`
+	PreBuildHook        PreBuildHook `json:"preBuildHook"`
+}
+
+type PreBuildHook struct {
+	Command string
+	Timeout time.Duration
+}
+
+func (h PreBuildHook) MarshalJSON() ([]byte, error) {
+	timeout := ""
+	if h.Timeout > 0 {
+		timeout = h.Timeout.String()
+	}
+	return json.Marshal(struct {
+		Command string `json:"command"`
+		Timeout string `json:"timeout"`
+	}{h.Command, timeout})
+}
+
+func (h *PreBuildHook) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Command string `json:"command"`
+		Timeout string `json:"timeout"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	h.Command = raw.Command
+	h.Timeout = 0
+	if raw.Timeout != "" {
+		timeout, err := time.ParseDuration(raw.Timeout)
+		if err != nil {
+			return fmt.Errorf("preBuildHook timeout: %w", err)
+		}
+		h.Timeout = timeout
+	}
+	return nil
+}
+
+const defaultPreBuildHookTimeout = 5 * time.Minute
+
+func RunPreBuildHook(ctx context.Context, hook PreBuildHook, buildDir string) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultPreBuildHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	arch := ""
+	if _, ok := archPlatforms[filepath.Base(buildDir)]; ok {
+		arch = filepath.Base(buildDir)
+	}
+	cmd := shellCommand(ctx, hook.Command)
+	cmd.Dir = buildDir
+	cmd.Env = append(os.Environ(), "BUILD_VERSION="+imageVersion(buildDir), "BUILD_ARCH="+arch)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	slog.Info("running pre-build hook", "dir", buildDir, "command", hook.Command)
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("pre-build hook timed out after %s", timeout)
+		}
+		return fmt.Errorf("pre-build hook: %w", err)
+	}
+	return nil
+}
+
+const defaultConfigFile = "release-config.json"
+
+var config = DefaultConfig()
+
+func DefaultConfig() Config {
+	return Config{
+		RegistryUser:        "openeuler2k8s",
+		RegistryPassword:    "changeme",
+		SourceBaseURL:       "https://repo.openeuler.org/",
+		TargetRepository:    "openeuler2k8s/openeuler",
+		Architectures:       []string{"x86_64", "aarch64", "riscv64"},
+		WorkDir:             ".",
+		DownloadConcurrency: 4,
+		RegistryType:        "dockerhub",
+		StateFile:           "release-state.json",
+		DownloadCacheFile:   "download-cache.json",
+		TagCacheTTL:         "1h",
+		ReleasesAPIURL:      "https://gitee.com/openeuler/openEuler-Advisor/raw/master/version-recommend/version_recommend.json",
+		HTTPTimeout:         "30s",
+		ScrapeParallelism:   2,
+		ScrapeDelay:         "500ms",
+		AvgArchiveSizeMB:    512,
+	}
+}
+
+func LoadConfig(FilePath string) (Config, error) {
+	cfg := DefaultConfig()
+	content, err := os.ReadFile(FilePath)
+	if os.IsNotExist(err) {
+		data, err := json.MarshalIndent(cfg, "", "  ")
+		if err != nil {
+			return cfg, err
+		}
+		slog.Info("config file not found, writing defaults", "path", FilePath)
+		return cfg, os.WriteFile(FilePath, append(data, '\n'), 0600)
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse config %s: %w", FilePath, err)
+	}
+	if len(cfg.Architectures) == 0 {
+		return cfg, fmt.Errorf("config %s: architectures must not be empty", FilePath)
+	}
+	if cfg.SigningKeyFile != "" {
+		if _, err := os.Stat(cfg.SigningKeyFile); err != nil {
+			return cfg, fmt.Errorf("config %s: signingKeyFile: %w", FilePath, err)
+		}
+	}
+	if cfg.AvgArchiveSizeMB < 0 {
+		return cfg, fmt.Errorf("config %s: avgArchiveSizeMB must not be negative", FilePath)
+	}
+	if cfg.ScrapeParallelism < 1 {
+		return cfg, fmt.Errorf("config %s: scrapeParallelism must be at least 1", FilePath)
+	}
+	if _, err := time.ParseDuration(cfg.ScrapeDelay); err != nil {
+		return cfg, fmt.Errorf("config %s: scrapeDelay: %w", FilePath, err)
+	}
+	if cfg.DownloadConcurrency < 1 {
+		return cfg, fmt.Errorf("config %s: downloadConcurrency must be at least 1", FilePath)
+	}
+	if _, err := time.ParseDuration(cfg.HTTPTimeout); err != nil {
+		return cfg, fmt.Errorf("config %s: httpTimeout: %w", FilePath, err)
+	}
+	if _, err := time.ParseDuration(cfg.TagCacheTTL); err != nil {
+		return cfg, fmt.Errorf("config %s: tagCacheTTL: %w", FilePath, err)
+	}
+	if !strings.HasSuffix(cfg.SourceBaseURL, "/") {
+		cfg.SourceBaseURL += "/"
+	}
+	return cfg, nil
+}
+
+type StateFile struct {
+	PushedTags []string  `json:"pushedTags"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func LoadState(FilePath string) (StateFile, error) {
+	var state StateFile
+	content, err := os.ReadFile(FilePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return state, fmt.Errorf("parse state %s: %w", FilePath, err)
+	}
+	return state, nil
+}
+
+func (s StateFile) Save(FilePath string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(FilePath, append(data, '\n'), 0644)
+}
+
+func CachedRegistryTags(ctx context.Context, registry RegistryClient, refresh bool) ([]string, error) {
+	ttl, err := time.ParseDuration(config.TagCacheTTL)
+	if err != nil {
+		return nil, err
+	}
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return nil, err
+	}
+	if !refresh && !state.UpdatedAt.IsZero() && time.Since(state.UpdatedAt) < ttl {
+		slog.Info("using cached registry tags", "path", config.StateFile, "age", time.Since(state.UpdatedAt).Round(time.Second))
+		return state.PushedTags, nil
+	}
+	tags, err := registry.ListTags(ctx, config.TargetRepository)
+	if err != nil {
+		return nil, err
+	}
+	state = StateFile{PushedTags: tags, UpdatedAt: time.Now()}
+	if err := state.Save(config.StateFile); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+var stateMu sync.Mutex
+
+func RecordPushedTag(tag string) error {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		return err
+	}
+	for _, existing := range state.PushedTags {
+		if existing == tag {
+			return nil
+		}
+	}
+	state.PushedTags = append(state.PushedTags, tag)
+	return state.Save(config.StateFile)
+}
+
 type WebPageInfo struct {
-	Path    string
-	URL     string
-	Version string
+	Path         string
+	URL          string
+	Version      string
+	LastModified time.Time
 }
 
 type DockerHubTag struct {
@@ -112,383 +718,4181 @@ type DockerHubTag struct {
 	} `json:"results"`
 }
 
-func GetOpenEulerTag() []string {
-	var Result []WebPageInfo
-	url := "https://repo.openeuler.org/"
-	c := colly.NewCollector(colly.UserAgent("Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.163 Safari/537.36"), colly.MaxDepth(1), colly.Debugger(&debug.LogDebugger{}))
-	c.OnHTML("table[id='list']", func(e *colly.HTMLElement) {
-		e.ForEach("td[class='link']", func(i int, item *colly.HTMLElement) {
-			var WebPageInfo WebPageInfo
-			WebPageInfo.Path = item.ChildText("a")
-			if MatchDockerImageDir(WebPageInfo.Path) {
-				WebPageInfo.Version = strings.ToLower(WebPageInfo.Path[10 : len(WebPageInfo.Path)-1])
-				WebPageInfo.URL = path.Join(url, item.ChildAttr("a", "href"))
-				Result = append(Result, WebPageInfo)
+func GetOpenEulerTag(ctx context.Context) ([]string, error) {
+	if config.ReleasesAPIURL != "" {
+		Tag, err := GetOpenEulerReleaseTag(ctx, config.ReleasesAPIURL)
+		if err == nil && len(Tag) > 0 {
+			return Tag, nil
+		}
+		slog.Warn("openEuler releases API unavailable, falling back to scraping", "url", config.ReleasesAPIURL, "err", err)
+	}
+	return ScrapeOpenEulerTag(ctx)
+}
+
+func GetOpenEulerReleaseTag(ctx context.Context, url string) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := httpClient(requestTimeout()).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{URL: url, StatusCode: res.StatusCode}
+	}
+	var releases []json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", url, err)
+	}
+	var Tag []string
+	for _, raw := range releases {
+		var version string
+		if err := json.Unmarshal(raw, &version); err != nil {
+			var release struct {
+				Version string `json:"version"`
+				Name    string `json:"name"`
 			}
-		})
-	})
-	err := c.Visit(url)
+			if err := json.Unmarshal(raw, &release); err != nil {
+				return nil, fmt.Errorf("decode %s: %w", url, err)
+			}
+			version = release.Version
+			if version == "" {
+				version = release.Name
+			}
+		}
+		version = strings.TrimPrefix(version, "openEuler-")
+		if version != "" && MatchDockerImageDir("openEuler-"+version) {
+			Tag = append(Tag, NormalizeTag(version))
+		}
+	}
+	return Tag, nil
+}
+
+func ScrapeOpenEulerTag(ctx context.Context) ([]string, error) {
+	Result, err := ScrapeOpenEulerPages(ctx)
 	if err != nil {
-		fmt.Println(err.Error())
+		return nil, err
 	}
 	var Tag []string
 	for i := 0; i < len(Result); i++ {
 		Tag = append(Tag, Result[i].Version)
 	}
-	return Tag
+	return Tag, nil
 }
 
-func MatchDockerImageDir(Text string) bool {
-	reg := regexp.MustCompile(`^openEuler-[\d].*`)
-	if len(reg.FindAllString(Text, -1)) == 1 {
-		return true
-	} else {
-		return false
+func fetchListing(ctx context.Context, url string) (*html.Node, error) {
+	release, err := acquireScrapeSlot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", scrapeUserAgent)
+	res, err := mirrorHTTPClient(requestTimeout()).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scrape %s: %w", url, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{URL: url, StatusCode: res.StatusCode}
+	}
+	doc, err := html.Parse(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", url, err)
+	}
+	return findElement(doc, "table", "id", "list"), nil
+}
+
+func GetOpenEulerTagWithArch(ctx context.Context, versions []string) (map[string][]string, error) {
+	Result := make(map[string][]string)
+	for _, version := range versions {
+		table, err := fetchListing(ctx, versionBaseURL(version))
+		var statusErr *HTTPStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			slog.Warn("version has no docker_img directory", "version", version)
+			Result[version] = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if table == nil {
+			continue
+		}
+		var names []string
+		for _, link := range findElements(table, "td", "class", "link") {
+			names = append(names, strings.TrimSpace(nodeText(link)))
+		}
+		for _, arch := range config.Architectures {
+			if SelectStringInList(arch+"/", names) || SelectStringInList("openEuler-docker."+arch+".tar.xz", names) {
+				Result[version] = append(Result[version], arch)
+			}
+		}
+	}
+	return Result, nil
+}
+
+var availableArchs map[string][]string
+
+func archsFor(version string, archs []string) []string {
+	supported, ok := availableArchs[version]
+	if !ok {
+		return archs
+	}
+	var Result []string
+	for _, arch := range archs {
+		if SelectStringInList(arch, supported) {
+			Result = append(Result, arch)
+		}
+	}
+	return Result
+}
+
+func ScrapeOpenEulerPages(ctx context.Context) ([]WebPageInfo, error) {
+	url := config.SourceBaseURL
+	table, err := fetchListing(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	var Result []WebPageInfo
+	if table == nil {
+		return nil, nil
+	}
+	for _, row := range findElements(table, "tr", "", "") {
+		link := findElement(row, "td", "class", "link")
+		if link == nil {
+			continue
+		}
+		a := findElement(link, "a", "", "")
+		if a == nil {
+			continue
+		}
+		var WebPageInfo WebPageInfo
+		WebPageInfo.Path = strings.TrimSpace(nodeText(a))
+		if !MatchDockerImageDir(WebPageInfo.Path) {
+			continue
+		}
+		WebPageInfo.Version = NormalizeTag(strings.TrimSuffix(WebPageInfo.Path[10:], "/"))
+		WebPageInfo.URL = path.Join(url, nodeAttr(a, "href"))
+		if td := findElement(row, "td", "class", "date"); td != nil {
+			date := strings.TrimSpace(nodeText(td))
+			modified, err := parseListingDate(date)
+			if err != nil {
+				slog.Warn("unparsable modification date", "path", WebPageInfo.Path, "date", date)
+			}
+			WebPageInfo.LastModified = modified
+		}
+		Result = append(Result, WebPageInfo)
+	}
+	return Result, nil
+}
+
+var (
+	scrapeSlotsOnce sync.Once
+	scrapeSlots     chan struct{}
+)
+
+func acquireScrapeSlot(ctx context.Context) (func(), error) {
+	scrapeSlotsOnce.Do(func() {
+		scrapeSlots = make(chan struct{}, config.ScrapeParallelism)
+	})
+	select {
+	case scrapeSlots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	delay, _ := time.ParseDuration(config.ScrapeDelay)
+	if delay > 0 {
+		delay += time.Duration(mathrand.Int63n(int64(delay)))
+	}
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		<-scrapeSlots
+		return nil, ctx.Err()
+	}
+	return func() { <-scrapeSlots }, nil
+}
+
+const scrapeUserAgent = "Mozilla/5.0 (Windows NT 10.0; WOW64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.163 Safari/537.36"
+
+func findElements(n *html.Node, tag, attr, value string) []*html.Node {
+	var Result []*html.Node
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == tag && (attr == "" || nodeAttr(n, attr) == value) {
+			Result = append(Result, n)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return Result
+}
+
+func findElement(n *html.Node, tag, attr, value string) *html.Node {
+	if found := findElements(n, tag, attr, value); len(found) > 0 {
+		return found[0]
+	}
+	return nil
+}
+
+func nodeAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
+
+var listingDateLayouts = []string{"2006-Jan-02 15:04", "02-Jan-2006 15:04", "2006-01-02 15:04", time.RFC3339}
+
+func parseListingDate(Text string) (time.Time, error) {
+	var err error
+	for _, layout := range listingDateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, strings.TrimSpace(Text)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func ParseSince(Text string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, Text); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", Text)
+}
+
+func FilterSince(ctx context.Context, Tag []string, since time.Time) ([]string, error) {
+	pages, err := ScrapeOpenEulerPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	modified := make(map[string]time.Time, len(pages))
+	for _, page := range pages {
+		modified[page.Version] = page.LastModified
+	}
+	var Result []string
+	for _, tag := range Tag {
+		t, ok := modified[tag]
+		if !ok || t.IsZero() {
+			slog.Warn("no modification date for version, skipping", "version", tag)
+			continue
+		}
+		if t.After(since) {
+			Result = append(Result, tag)
+		}
+	}
+	return Result, nil
+}
+
+func FilterTags(Tag []string, filter *regexp.Regexp) []string {
+	if filter == nil {
+		return Tag
+	}
+	var Result []string
+	for i := 0; i < len(Tag); i++ {
+		if filter.MatchString(Tag[i]) {
+			Result = append(Result, Tag[i])
+		}
+	}
+	return Result
+}
+
+func MatchDockerImageDir(Text string) bool {
+	reg := regexp.MustCompile(`^openEuler-[\d].*`)
+	if len(reg.FindAllString(Text, -1)) == 1 {
+		return true
+	} else {
+		return false
+	}
+}
+
+const maxDockerHubResponse = 8 << 20
+
+func GetDockerHubTag(ctx context.Context, repo string) ([]string, error) {
+	return GetDockerHubTagFromURL(ctx, dockerHubAPI+"/repositories/"+repo+"/tags")
+}
+
+func GetDockerHubTagFromURL(ctx context.Context, url string) ([]string, error) {
+	method := "GET"
+	client := &DockerHubRateLimitAwareFetcher{Client: httpClient(requestTimeout()), MaxRetries: *rateLimitRetries}
+	var Tag []string
+	for url != "" {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, &HTTPStatusError{URL: url, StatusCode: res.StatusCode}
+		}
+		var DockerHubTag DockerHubTag
+		err = json.NewDecoder(io.LimitReader(res.Body, maxDockerHubResponse)).Decode(&DockerHubTag)
+		res.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", url, err)
+		}
+		for i := 0; i < len(DockerHubTag.Results); i++ {
+			if DockerHubTag.Results[i].Name != "latest" {
+				Tag = append(Tag, DockerHubTag.Results[i].Name)
+			}
+		}
+		url = DockerHubTag.Next
+	}
+	return Tag, nil
+}
+
+const dockerHubAPI = "https://hub.docker.com/v2"
+
+const defaultRetryAfter = 60 * time.Second
+
+type DockerHubRateLimitAwareFetcher struct {
+	Client     *http.Client
+	MaxRetries int
+}
+
+func (f *DockerHubRateLimitAwareFetcher) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := f.Client.Do(req)
+		if err != nil || res.StatusCode != http.StatusTooManyRequests || attempt >= f.MaxRetries {
+			return res, err
+		}
+		wait := retryAfter(res.Header.Get("Retry-After"))
+		res.Body.Close()
+		slog.Warn("docker hub rate limit hit, waiting", "url", req.URL.String(), "attempt", attempt+1, "maxRetries", f.MaxRetries, "wait", wait)
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return defaultRetryAfter
+}
+
+var tagVersion = regexp.MustCompile(`(?i)\d+\.\d+(?:-lts)?(?:-sp\d+)?`)
+
+func UntrackedTags(hubTags, repoTags []string) []string {
+	upstream := make(map[string]bool, len(repoTags))
+	for _, version := range repoTags {
+		upstream[NormalizeTag(version)] = true
+	}
+	var Result []string
+	for _, tag := range hubTags {
+		version := tagVersion.FindString(tag)
+		if version == "" {
+			continue
+		}
+		if !upstream[NormalizeTag(version)] {
+			Result = append(Result, tag)
+		}
+	}
+	return Result
+}
+
+func DeleteUntrackedTags(ctx context.Context, hubTags, repoTags []string, dryRun bool) ([]string, error) {
+	if len(repoTags) == 0 {
+		return nil, errors.New("upstream version list is empty, refusing to treat every tag as untracked")
+	}
+	untracked := UntrackedTags(hubTags, repoTags)
+	if len(untracked) == 0 || dryRun {
+		return untracked, nil
+	}
+	if *maxDeleteTags > 0 && len(untracked) > *maxDeleteTags {
+		return nil, fmt.Errorf("%d untracked tags exceeds --max-delete %d: %s", len(untracked), *maxDeleteTags, strings.Join(untracked, ", "))
+	}
+	if !*assumeYes && !confirm(os.Stdin, os.Stderr, fmt.Sprintf("delete %d tags from %s: %s?", len(untracked), config.TargetRepository, strings.Join(untracked, ", "))) {
+		return nil, errors.New("deletion not confirmed")
+	}
+	authConfig, err := RegistryCredentials()
+	if err != nil {
+		return nil, err
+	}
+	token, err := dockerHubLogin(ctx, authConfig)
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, tag := range untracked {
+		req, err := http.NewRequestWithContext(ctx, http.MethodDelete, dockerHubAPI+"/repositories/"+config.TargetRepository+"/tags/"+tag+"/", nil)
+		if err != nil {
+			return deleted, err
+		}
+		req.Header.Set("Authorization", "JWT "+token)
+		res, err := httpClient(requestTimeout()).Do(req)
+		if err != nil {
+			return deleted, err
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+			return deleted, &HTTPStatusError{URL: req.URL.String(), StatusCode: res.StatusCode}
+		}
+		slog.Info("deleted tag", "repository", config.TargetRepository, "tag", tag)
+		deleted = append(deleted, tag)
+	}
+	return deleted, nil
+}
+
+var ltsPattern = regexp.MustCompile(`^\d+\.\d+-lts(-sp\d+)?$`)
+
+func UpdateLatestTag(ctx context.Context, registry RegistryClient, newestVersion string) error {
+	if !IsLTSVersion(newestVersion) {
+		slog.Info("not an LTS release, leaving latest alone", "version", newestVersion)
+		return nil
+	}
+	return moveAlias(ctx, registry, newestVersion, "latest")
+}
+
+func IsLTSVersion(version string) bool {
+	return ltsPattern.MatchString(NormalizeTag(version))
+}
+
+func UpdateLTSAlias(ctx context.Context, registry RegistryClient, latestLTS string) error {
+	if !IsLTSVersion(latestLTS) {
+		return fmt.Errorf("%s is not an LTS release", latestLTS)
+	}
+	return moveAlias(ctx, registry, latestLTS, "lts")
+}
+
+func UpdateAliases(ctx context.Context) error {
+	if (!*checkLatest && !*tagAllLTS) || latestLTS == "" {
+		return nil
+	}
+	registry, err := NewRegistryClient(config)
+	if err != nil {
+		return err
+	}
+	tag := imageTag(latestLTS, "")
+	var statusErr *HTTPStatusError
+	if _, _, _, err := getManifest(ctx, registry, tag); errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		slog.Warn("newest LTS has no version tag in the registry, leaving aliases alone; push an image index with --push-manifest-list", "tag", registry.ImageRef(tag))
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("fetch %s: %w", registry.ImageRef(tag), err)
+	}
+	if *checkLatest {
+		if err := UpdateLatestTag(ctx, registry, latestLTS); err != nil {
+			return fmt.Errorf("update latest tag: %w", err)
+		}
+	}
+	if *tagAllLTS {
+		if err := UpdateLTSAlias(ctx, registry, latestLTS); err != nil {
+			return fmt.Errorf("update lts tag: %w", err)
+		}
+	}
+	return nil
+}
+
+func isIndexMedia(mediaType string) bool {
+	return mediaType == ociImageIndexMedia || mediaType == "application/vnd.docker.distribution.manifest.list.v2+json"
+}
+
+func moveAlias(ctx context.Context, registry RegistryClient, version, alias string) error {
+	tag := imageTag(version, "")
+	_, mediaType, _, err := getManifest(ctx, registry, tag)
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", registry.ImageRef(tag), err)
+	}
+	if !isIndexMedia(mediaType) {
+		if _, current, _, err := getManifest(ctx, registry, alias); err == nil && isIndexMedia(current) {
+			return fmt.Errorf("%s is a single-arch image, refusing to replace the multi-arch %s", registry.ImageRef(tag), registry.ImageRef(alias))
+		}
+	}
+	return CopyManifest(ctx, registry, tag, alias)
+}
+
+func dockerHubLogin(ctx context.Context, authConfig types.AuthConfig) (string, error) {
+	body, err := json.Marshal(map[string]string{"username": authConfig.Username, "password": authConfig.Password})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dockerHubAPI+"/users/login/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := httpClient(requestTimeout()).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", &HTTPStatusError{URL: req.URL.String(), StatusCode: res.StatusCode}
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&login); err != nil {
+		return "", err
+	}
+	return login.Token, nil
+}
+
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+type RegistryClient interface {
+	ListTags(ctx context.Context, repo string) ([]string, error)
+	PushImage(ctx context.Context, image, tag string) error
+	ImageRef(tag string) string
+	AuthConfig() (types.AuthConfig, error)
+}
+
+func NewRegistryClient(cfg Config) (RegistryClient, error) {
+	switch cfg.RegistryType {
+	case "", "dockerhub":
+		return &DockerHubRegistryClient{Repository: cfg.TargetRepository}, nil
+	case "oci":
+		if cfg.RegistryURL == "" {
+			return nil, errors.New("registryURL is required for registryType oci")
+		}
+		return &GenericOCIRegistryClient{
+			BaseURL:    strings.TrimSuffix(cfg.RegistryURL, "/"),
+			Repository: cfg.TargetRepository,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown registryType %q", cfg.RegistryType)
+	}
+}
+
+type DockerHubRegistryClient struct {
+	Repository string
+}
+
+func (c *DockerHubRegistryClient) ListTags(ctx context.Context, repo string) ([]string, error) {
+	return GetDockerHubTag(ctx, repo)
+}
+
+func (c *DockerHubRegistryClient) PushImage(ctx context.Context, image, tag string) error {
+	authConfig, err := c.AuthConfig()
+	if err != nil {
+		return err
+	}
+	return pushWithDaemon(ctx, image, c.ImageRef(tag), authConfig)
+}
+
+func (c *DockerHubRegistryClient) ImageRef(tag string) string {
+	return c.Repository + ":" + tag
+}
+
+func (c *DockerHubRegistryClient) AuthConfig() (types.AuthConfig, error) {
+	return RegistryCredentials()
+}
+
+type GenericOCIRegistryClient struct {
+	BaseURL          string
+	Repository       string
+	DockerConfigOnly bool
+}
+
+func (c *GenericOCIRegistryClient) host() string {
+	host := c.BaseURL
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	return host
+}
+
+func (c *GenericOCIRegistryClient) ListTags(ctx context.Context, repo string) ([]string, error) {
+	var Tag []string
+	next := c.BaseURL + "/v2/" + repo + "/tags/list"
+	token := ""
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := httpClient(requestTimeout()).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode == http.StatusUnauthorized && token == "" {
+			challenge := res.Header.Get("WWW-Authenticate")
+			res.Body.Close()
+			if token, err = ociBearerToken(ctx, challenge, c.credentials()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, &HTTPStatusError{URL: next, StatusCode: res.StatusCode}
+		}
+		var page struct {
+			Name string   `json:"name"`
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&page)
+		res.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, tag := range page.Tags {
+			if tag != "latest" {
+				Tag = append(Tag, tag)
+			}
+		}
+		next = nextLink(c.BaseURL, res.Header.Get("Link"))
+	}
+	return Tag, nil
+}
+
+func (c *GenericOCIRegistryClient) PushImage(ctx context.Context, image, tag string) error {
+	return pushWithDaemon(ctx, image, c.ImageRef(tag), c.credentials())
+}
+
+func (c *GenericOCIRegistryClient) ImageRef(tag string) string {
+	return c.host() + "/" + c.Repository + ":" + tag
+}
+
+func (c *GenericOCIRegistryClient) AuthConfig() (types.AuthConfig, error) {
+	return c.credentials(), nil
+}
+
+func (c *GenericOCIRegistryClient) credentials() types.AuthConfig {
+	authConfig := types.AuthConfig{
+		Username:      config.RegistryUser,
+		Password:      config.RegistryPassword,
+		ServerAddress: c.host(),
+	}
+	if c.DockerConfigOnly {
+		authConfig = types.AuthConfig{ServerAddress: c.host()}
+	}
+	if fileAuth, err := dockerConfigAuth(c.host()); err == nil && fileAuth.Password != "" {
+		authConfig = fileAuth
+	}
+	return authConfig
+}
+
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+func ociBearerToken(ctx context.Context, challenge string, authConfig types.AuthConfig) (string, error) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+	params := map[string]string{}
+	for _, match := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"], nil)
+	if err != nil {
+		return "", err
+	}
+	query := req.URL.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	req.URL.RawQuery = query.Encode()
+	if authConfig.Username != "" {
+		req.SetBasicAuth(authConfig.Username, authConfig.Password)
+	}
+	res, err := httpClient(requestTimeout()).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", &HTTPStatusError{URL: params["realm"], StatusCode: res.StatusCode}
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token == "" {
+		return token.AccessToken, nil
+	}
+	return token.Token, nil
+}
+
+const aliyunRegistry = "https://registry.cn-hangzhou.aliyuncs.com"
+
+func GetAliyunMirrorTags(ctx context.Context, repo string) ([]string, error) {
+	registry := &GenericOCIRegistryClient{BaseURL: aliyunRegistry, Repository: repo, DockerConfigOnly: true}
+	return registry.ListTags(ctx, repo)
+}
+
+func nextLink(baseURL, link string) string {
+	start := strings.Index(link, "<")
+	end := strings.Index(link, ">")
+	if start < 0 || end < start || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	next := link[start+1 : end]
+	if strings.HasPrefix(next, "/") {
+		return baseURL + next
+	}
+	return next
+}
+
+func pushWithDaemon(ctx context.Context, image, ref string, authConfig types.AuthConfig) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	if err := cli.ImageTag(ctx, image, ref); err != nil {
+		return err
+	}
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return err
+	}
+	return retryPushImage(ctx, cli, ref, base64.URLEncoding.EncodeToString(encodedJSON))
+}
+
+func pushImage(ctx context.Context, cli *client.Client, name, authStr string) error {
+	if err := streamPush(ctx, cli, name, authStr); err != nil {
+		image, tag := name, "latest"
+		if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+			image, tag = name[:i], name[i+1:]
+		}
+		return &PushError{Image: image, Tag: tag, Cause: err}
+	}
+	return nil
+}
+
+func RetryPush(ctx context.Context, n int, backoff time.Duration, push func() error) error {
+	var err error
+	for attempt := 0; attempt < n; attempt++ {
+		if err = push(); err == nil {
+			return nil
+		}
+		if !IsTransientPushError(err) {
+			return err
+		}
+		if attempt == n-1 {
+			break
+		}
+		delay := backoff << attempt
+		if backoff > 0 {
+			delay += time.Duration(mathrand.Int63n(int64(backoff)))
+		}
+		slog.Warn("push failed, retrying", "attempt", attempt+1, "maxAttempts", n, "delay", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+var transientPushErrors = []string{"toomanyrequests", "too many requests", "service unavailable", "timeout", "connection reset", "unexpected eof"}
+
+func IsTransientPushError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Temporary()
+	}
+	msg := strings.ToLower(err.Error())
+	for _, transient := range transientPushErrors {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
+
+func retryPushImage(ctx context.Context, cli *client.Client, name, authStr string) error {
+	return RetryPush(ctx, *pushRetries, *pushBackoff, func() error {
+		return pushImage(ctx, cli, name, authStr)
+	})
+}
+
+func streamPush(ctx context.Context, cli *client.Client, name, authStr string) error {
+	resp, err := cli.ImagePush(ctx, name, types.ImagePushOptions{RegistryAuth: authStr})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	progress := make(map[string]*ProgressWriter)
+	rd := bufio.NewReader(resp)
+	for {
+		n, _, err := rd.ReadLine()
+		if err != nil && err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		var message struct {
+			ID             string          `json:"id"`
+			Status         string          `json:"status"`
+			Error          json.RawMessage `json:"error"`
+			ProgressDetail struct {
+				Current int64 `json:"current"`
+				Total   int64 `json:"total"`
+			} `json:"progressDetail"`
+		}
+		if err := json.Unmarshal(n, &message); err != nil {
+			return err
+		}
+		if len(message.Error) > 0 {
+			return fmt.Errorf("%s", message.Error)
+		}
+		if message.ProgressDetail.Total > 0 {
+			p, ok := progress[message.ID]
+			if !ok {
+				p = NewProgressWriter("正在推送 "+message.ID, message.ProgressDetail.Total)
+				progress[message.ID] = p
+			}
+			p.Set(message.ProgressDetail.Current, message.ProgressDetail.Total)
+			continue
+		}
+		slog.Info("push", "image", name, "id", message.ID, "status", message.Status)
+	}
+	return nil
+}
+
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func SelectStringInList(SrcString string, DestinationTag []string) bool {
+	SrcString = NormalizeTag(SrcString)
+	for i := 0; i < len(DestinationTag); i++ {
+		if NormalizeTag(DestinationTag[i]) == SrcString {
+			return true
+		}
+	}
+	return false
+}
+
+func MatchTag(SourceTag []string, DestinationTag []string) []string {
+	var Result []string
+	for i := 0; i < len(SourceTag); i++ {
+		if SelectStringInList(SourceTag[i], DestinationTag) {
+			continue
+		} else {
+			Result = append(Result, SourceTag[i])
+		}
+	}
+	SortVersions(Result)
+	return Result
+}
+
+var versionPattern = regexp.MustCompile(`^(\d+)\.(\d+)(-lts)?(?:-sp(\d+))?(.*)$`)
+
+func parseVersion(version string) ([4]int, string, bool) {
+	m := versionPattern.FindStringSubmatch(strings.ToLower(version))
+	if m == nil {
+		return [4]int{}, "", false
+	}
+	var key [4]int
+	key[0], _ = strconv.Atoi(m[1])
+	key[1], _ = strconv.Atoi(m[2])
+	if m[3] != "" {
+		key[2] = 1
+	}
+	if m[4] != "" {
+		key[3], _ = strconv.Atoi(m[4])
+	}
+	return key, m[5], true
+}
+
+func CompareVersion(a, b string) int {
+	keyA, restA, okA := parseVersion(a)
+	keyB, restB, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := range keyA {
+		if keyA[i] != keyB[i] {
+			if keyA[i] < keyB[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return strings.Compare(restA, restB)
+}
+
+func ApplyForce(MatchResult []string, OpenEulerTag []string, force string, forceAll bool) ([]string, error) {
+	if forceAll {
+		Result := append([]string(nil), OpenEulerTag...)
+		SortVersions(Result)
+		return Result, nil
+	}
+	if force == "" {
+		return MatchResult, nil
+	}
+	force = strings.ToLower(force)
+	if !SelectStringInList(force, OpenEulerTag) {
+		return nil, fmt.Errorf("forced version %s is not available upstream", force)
+	}
+	if SelectStringInList(force, MatchResult) {
+		return MatchResult, nil
+	}
+	Result := append(append([]string(nil), MatchResult...), force)
+	SortVersions(Result)
+	return Result, nil
+}
+
+func SortVersions(versions []string) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		return CompareVersion(versions[i], versions[j]) < 0
+	})
+}
+
+func PathExists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func sha256encode(FilePath string) (string, error) {
+	f, err := os.Open(FilePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("hash %s: %w", FilePath, err)
+	}
+	result := h.Sum(nil)
+	hex_string_data := hex.EncodeToString(result)
+	return hex_string_data, nil
+}
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func ReadFile(FilePath string) (string, error) {
+	content, err := os.ReadFile(FilePath)
+	if err != nil {
+		return "", err
+	}
+	sum := strings.TrimSpace(string(content))
+	if fields := strings.Fields(sum); len(fields) > 0 {
+		sum = fields[0]
+	}
+	if !sha256Hex.MatchString(sum) {
+		return "", fmt.Errorf("%s: not a sha256 sum: %q", FilePath, sum)
+	}
+	return sum, nil
+}
+
+//go:embed templates
+var templateFS embed.FS
+
+var dockerfileTmpl = template.Must(template.ParseFS(templateFS, "templates/Dockerfile.tmpl")).Option("missingkey=error")
+
+func writeDockerfile(dir, version, arch string) error {
+	dst := filepath.Join(dir, "Dockerfile")
+	if config.DockerfilePath != "" {
+		return CopyDockerfileIfNewer(config.DockerfilePath, dst)
+	}
+	var b bytes.Buffer
+	if err := dockerfileTmpl.Execute(&b, TagFields{Version: version, Arch: arch}); err != nil {
+		return fmt.Errorf("render Dockerfile template: %w", err)
+	}
+	content := b.Bytes()
+	if current, err := os.ReadFile(dst); err == nil && bytes.Equal(current, content) {
+		return nil
+	}
+	return os.WriteFile(dst, content, 0644)
+}
+
+func CopyDockerfileIfNewer(src, dst string) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if dstInfo, err := os.Stat(dst); err == nil && !srcInfo.ModTime().After(dstInfo.ModTime()) {
+		return nil
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, content, 0644); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime())
+}
+
+func ImagePrepare(ctx context.Context, MatchResult []string, archs []string) []error {
+	sem := make(chan struct{}, config.DownloadConcurrency)
+	var mu sync.Mutex
+	var errs []error
+	var tasks []VerifyTask
+	for i := 0; i < len(MatchResult); i++ {
+		versionArchs := archsFor(MatchResult[i], archs)
+		for j := 0; j < len(versionArchs); j++ {
+			wg.Add(1)
+			go func(version, arch string) {
+				defer wg.Done()
+				task, err := downloadArch(ctx, version, arch, sem)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%s/%s: %w", version, arch, err))
+					return
+				}
+				tasks = append(tasks, task)
+			}(MatchResult[i], versionArchs[j])
+		}
+	}
+	wg.Wait()
+	errs = append(errs, VerifyAll(ctx, tasks)...)
+	ReportIntegrityFailures(ctx, tasks)
+	for _, task := range tasks {
+		if task.Err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(task VerifyTask) {
+			defer wg.Done()
+			if err := unpackArch(task.Version, task.Arch); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s/%s: %w", task.Version, task.Arch, err))
+				mu.Unlock()
+			}
+		}(task)
+	}
+	wg.Wait()
+	return errs
+}
+
+func archDir(version, arch string) (string, error) {
+	return filepath.Abs(filepath.Join(config.WorkDir, "openEuler", version, arch))
+}
+
+func downloadArch(ctx context.Context, version, arch string, sem chan struct{}) (VerifyTask, error) {
+	dir, err := archDir(version, arch)
+	if err != nil {
+		return VerifyTask{}, err
+	}
+	err = os.MkdirAll(dir, 0766)
+	if err != nil {
+		return VerifyTask{}, err
+	}
+	imageFile := "openEuler-docker." + arch + ".tar.xz"
+	sha256sumFile := imageFile + ".sha256sum"
+	imagePath := filepath.Join(dir, imageFile)
+	sha256sumPath := filepath.Join(dir, sha256sumFile)
+	files := map[string]string{
+		imageFile:     imagePath,
+		sha256sumFile: sha256sumPath,
+	}
+	if config.SigningKeyFile != "" {
+		files[sha256sumFile+".asc"] = sha256sumPath + ".asc"
+	}
+	if *skipDownload {
+		for _, filePath := range files {
+			isExist, err := PathExists(filePath)
+			if err != nil {
+				return VerifyTask{}, err
+			}
+			if !isExist {
+				return VerifyTask{}, fmt.Errorf("--skip-download: %s is missing", filePath)
+			}
+		}
+		return VerifyTask{Version: version, Arch: arch, ImagePath: imagePath}, nil
+	}
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return VerifyTask{}, ctx.Err()
+	}
+	audit.Log(AuditEvent{Event: "download_started", Version: version, Arch: arch})
+	downloadStart := time.Now()
+	candidates := archBaseURLs(version, arch)
+	for i, BasicURL := range candidates {
+		err = downloadMissing(ctx, BasicURL, files)
+		var statusErr *HTTPStatusError
+		if err == nil || i == len(candidates)-1 || !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+			break
+		}
+		slog.Info("image not found, trying alternate layout", "version", version, "arch", arch, "url", statusErr.URL)
+	}
+	<-sem
+	if err != nil {
+		errorsTotal.WithLabelValues(version, arch).Inc()
+		return VerifyTask{}, err
+	}
+	downloadsTotal.WithLabelValues(version, arch).Inc()
+	durationSeconds.WithLabelValues("download").Observe(time.Since(downloadStart).Seconds())
+	audit.Log(AuditEvent{Event: "download_complete", Version: version, Arch: arch, Duration: time.Since(downloadStart).Round(time.Millisecond).String()})
+	return VerifyTask{Version: version, Arch: arch, ImagePath: imagePath}, nil
+}
+
+type VerifyTask struct {
+	Version   string
+	Arch      string
+	ImagePath string
+	Err       error
+}
+
+func VerifyAll(ctx context.Context, tasks []VerifyTask) []error {
+	if config.SigningKeyFile == "" && len(tasks) > 0 {
+		slog.Warn("signingKeyFile is not configured, skipping GPG verification of sha256sum files; only checksums are verified, which does not detect a tampered mirror")
+	}
+	jobs := make(chan int)
+	var workers sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				tasks[j].Err = verifyTask(tasks[j])
+			}
+		}()
+	}
+	for i := range tasks {
+		jobs <- i
+	}
+	close(jobs)
+	workers.Wait()
+	var errs []error
+	for _, task := range tasks {
+		if task.Err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", task.Version, task.Arch, task.Err))
+		}
+	}
+	return errs
+}
+
+func ReportIntegrityFailures(ctx context.Context, tasks []VerifyTask) {
+	if *integrityRepo == "" {
+		return
+	}
+	for _, task := range tasks {
+		var mismatch *Sha256MismatchError
+		if !errors.As(task.Err, &mismatch) {
+			continue
+		}
+		if err := ReportIntegrityFailure(ctx, task.Version, task.Arch, mismatch.Expected, mismatch.Got); err != nil {
+			slog.Warn("open integrity issue", "version", task.Version, "arch", task.Arch, "err", err)
+		}
+	}
+}
+
+func ReportIntegrityFailure(ctx context.Context, version, arch, expected, got string) error {
+	title := fmt.Sprintf("sha256 mismatch for openEuler %s %s", version, arch)
+	body := fmt.Sprintf("The downloaded image for openEuler %s (%s) did not match its published checksum.\n\n"+
+		"- source: %s\n- expected: `%s`\n- got: `%s`\n\n"+
+		"This is either a corrupted download or a tampered artifact; the image was not built.\n",
+		version, arch, strings.Join(archBaseURLs(version, arch), ", "), expected, got)
+	return createGitHubIssue(ctx, *integrityRepo, title, body)
+}
+
+const githubAPI = "https://api.github.com"
+
+func githubCreate(ctx context.Context, path string, payload any) error {
+	token := *githubToken
+	if token == "" {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	if token == "" {
+		return errors.New("--github-token or $GITHUB_TOKEN is not set")
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, githubAPI+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	res, err := httpClient(requestTimeout()).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return fmt.Errorf("%s: %s", res.Status, msg)
+	}
+	return nil
+}
+
+func createGitHubIssue(ctx context.Context, repo, title, body string) error {
+	if err := githubCreate(ctx, "/repos/"+repo+"/issues", map[string]any{"title": title, "body": body, "labels": []string{"integrity"}}); err != nil {
+		return fmt.Errorf("create issue in %s: %w", repo, err)
+	}
+	slog.Info("opened integrity issue", "repo", repo, "title", title)
+	return nil
+}
+
+func verifyTask(task VerifyTask) error {
+	sha256sumPath := task.ImagePath + ".sha256sum"
+	if config.SigningKeyFile != "" {
+		if err := VerifySha256Signature(sha256sumPath, sha256sumPath+".asc", config.SigningKeyFile); err != nil {
+			return err
+		}
+	}
+	digest, err := verifyImageSha256(task.ImagePath)
+	if err != nil {
+		return err
+	}
+	audit.Log(AuditEvent{Event: "sha256_verified", Version: task.Version, Arch: task.Arch, Digest: "sha256:" + digest})
+	return nil
+}
+
+func unpackArch(version, arch string) error {
+	dir, err := archDir(version, arch)
+	if err != nil {
+		return err
+	}
+	imageFile := "openEuler-docker." + arch + ".tar.xz"
+	imagePath := filepath.Join(dir, imageFile)
+	rootfsPath := filepath.Join(dir, "openEuler-docker-rootfs."+arch+".tar")
+	isExist, err := PathExists(rootfsPath + ".xz")
+	if err != nil {
+		return err
+	}
+	if !isExist {
+		if err := extractTarEntries(imagePath, dir); err != nil {
+			return err
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, "*.tar"))
+		if err != nil {
+			return err
+		}
+		tarFileName := ""
+		for _, match := range matches {
+			if !strings.HasPrefix(filepath.Base(match), "openEuler") {
+				tarFileName = match
+				break
+			}
+		}
+		if tarFileName == "" {
+			return fmt.Errorf("no rootfs tarball found in %s", imageFile)
+		}
+		if err := os.Rename(tarFileName, rootfsPath); err != nil {
+			return err
+		}
+		if err := compressXz(rootfsPath, rootfsPath+".xz"); err != nil {
+			return err
+		}
+		if err := os.Remove(rootfsPath); err != nil {
+			return err
+		}
+		if err := os.Remove(rootfsPath + ".xz.sha256sum"); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := writeDockerfile(dir, version, arch); err != nil {
+		return err
+	}
+	return VerifyRootfsSha256(rootfsPath + ".xz")
+}
+
+func extractTarEntries(archivePath, dir string) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	xr, err := xz.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(xr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(header.Name)
+		if header.Typeflag != tar.TypeReg || strings.Contains(name, "/") || path.Ext(name) != ".tar" || name == "layer.tar" {
+			continue
+		}
+		out, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, tr); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+var xzPresetDictCap = [10]int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+func compressXz(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	xw, err := xz.WriterConfig{DictCap: xzPresetDictCap[*xzLevel]}.NewWriter(out)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(xw, bufio.NewReader(in)); err != nil {
+		return err
+	}
+	if err := xw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func VerifySha256Signature(sumPath, signaturePath, keyFile string) error {
+	keyData, err := os.Open(keyFile)
+	if err != nil {
+		return err
+	}
+	defer keyData.Close()
+	keyring, err := openpgp.ReadArmoredKeyRing(keyData)
+	if err != nil {
+		return fmt.Errorf("read signing key %s: %w", keyFile, err)
+	}
+	sum, err := os.Open(sumPath)
+	if err != nil {
+		return err
+	}
+	defer sum.Close()
+	signature, err := os.Open(signaturePath)
+	if err != nil {
+		return err
+	}
+	defer signature.Close()
+	signer, err := openpgp.CheckArmoredDetachedSignature(keyring, sum, signature)
+	if err != nil {
+		return fmt.Errorf("verify signature of %s: %w", sumPath, err)
+	}
+	slog.Debug("sha256sum signature valid", "path", sumPath, "key", fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint))
+	return nil
+}
+
+func VerifyDownloads(ctx context.Context, w io.Writer, root string) (bool, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "openEuler", "*", "*"))
+	if err != nil {
+		return false, err
+	}
+	var tasks []VerifyTask
+	for _, dir := range dirs {
+		arch := filepath.Base(dir)
+		imagePath := filepath.Join(dir, "openEuler-docker."+arch+".tar.xz")
+		if isExist, err := PathExists(imagePath); err != nil || !isExist {
+			continue
+		}
+		tasks = append(tasks, VerifyTask{Version: filepath.Base(filepath.Dir(dir)), Arch: arch, ImagePath: imagePath})
+	}
+	errs := VerifyAll(ctx, tasks)
+	for _, task := range tasks {
+		if task.Err != nil {
+			fmt.Fprintf(w, "FAIL %s/%s: %v\n", task.Version, task.Arch, task.Err)
+			continue
+		}
+		fmt.Fprintf(w, "PASS %s/%s\n", task.Version, task.Arch)
+	}
+	return len(errs) == 0, nil
+}
+
+func verifyImageSha256(imagePath string) (string, error) {
+	SrcSha256, err := sha256encode(imagePath)
+	if err != nil {
+		return "", err
+	}
+	DestSha256, err := ReadFile(imagePath + ".sha256sum")
+	if err != nil {
+		return "", err
+	}
+	if SrcSha256 != DestSha256 {
+		return "", &Sha256MismatchError{File: imagePath, Expected: DestSha256, Got: SrcSha256}
+	}
+	return SrcSha256, nil
+}
+
+func VerifyRootfsSha256(RootfsPath string) error {
+	sha256sumPath := RootfsPath + ".sha256sum"
+	SrcSha256, err := sha256encode(RootfsPath)
+	if err != nil {
+		return err
+	}
+	isExist, err := PathExists(sha256sumPath)
+	if err != nil {
+		return err
+	}
+	if !isExist {
+		content := SrcSha256 + "  " + filepath.Base(RootfsPath) + "\n"
+		return os.WriteFile(sha256sumPath, []byte(content), 0644)
+	}
+	DestSha256, err := ReadFile(sha256sumPath)
+	if err != nil {
+		return err
+	}
+	if SrcSha256 != DestSha256 {
+		return &Sha256MismatchError{File: RootfsPath, Expected: DestSha256, Got: SrcSha256}
+	}
+	return nil
+}
+
+func versionBaseURL(version string) string {
+	return config.SourceBaseURL + "openEuler-" + strings.ToUpper(version) + "/docker_img/"
+}
+
+func imageURL(version, arch string) string {
+	return archBaseURLs(version, arch)[0] + "openEuler-docker." + arch + ".tar.xz"
+}
+
+func archBaseURLs(version, arch string) []string {
+	URLs := []string{versionBaseURL(version) + arch + "/"}
+	if arch == "riscv64" {
+		URLs = append(URLs, versionBaseURL(version))
+	}
+	return URLs
+}
+
+func targetTag(version string) string {
+	return config.TargetRepository + ":" + imageTag(version, "")
+}
+
+type TagFields struct {
+	Version string
+	Arch    string
+}
+
+func imageTag(version, arch string) string {
+	if tagTmpl != nil {
+		var b strings.Builder
+		if err := tagTmpl.Execute(&b, TagFields{Version: version, Arch: arch}); err != nil {
+			slog.Error("render --tag-template", "version", version, "arch", arch, "err", err)
+		} else {
+			return b.String()
+		}
+	}
+	parts := []string{version}
+	if *tagPrefix != "" {
+		parts = append([]string{*tagPrefix}, parts...)
+	}
+	if *tagSuffix != "" {
+		parts = append(parts, *tagSuffix)
+	}
+	if arch != "" {
+		parts = append(parts, arch)
+	}
+	return strings.Join(parts, "-")
+}
+
+func PublishedVersions(OpenEulerTag []string, RegistryTag []string) []string {
+	var Result []string
+	for _, version := range OpenEulerTag {
+		if SelectStringInList(imageTag(version, ""), RegistryTag) {
+			Result = append(Result, version)
+		}
+	}
+	return Result
+}
+
+type PlanEntry struct {
+	Version   string `json:"version"`
+	Arch      string `json:"arch"`
+	SourceURL string `json:"sourceURL"`
+	TargetTag string `json:"targetTag"`
+}
+
+func PrintPlan(w io.Writer, MatchResult []string, archs []string, format string) error {
+	var plan []PlanEntry
+	for i := 0; i < len(MatchResult); i++ {
+		versionArchs := archsFor(MatchResult[i], archs)
+		for j := 0; j < len(versionArchs); j++ {
+			plan = append(plan, PlanEntry{
+				Version:   MatchResult[i],
+				Arch:      versionArchs[j],
+				SourceURL: imageURL(MatchResult[i], versionArchs[j]),
+				TargetTag: targetTag(MatchResult[i]),
+			})
+		}
+	}
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tARCH\tSOURCE URL\tTARGET TAG")
+		for _, entry := range plan {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", entry.Version, entry.Arch, entry.SourceURL, entry.TargetTag)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func downloadMissing(ctx context.Context, BasicURL string, files map[string]string) error {
+	for name, filePath := range files {
+		isExist, err := PathExists(filePath)
+		if err != nil {
+			return err
+		}
+		if isExist {
+			continue
+		}
+		url := BasicURL + name
+		if cached, ok := downloadCache.Lookup(url); ok {
+			if err := linkOrCopy(cached.LocalPath, filePath); err == nil {
+				slog.Info("using cached download", "url", url, "path", filePath, "cached", cached.LocalPath)
+				continue
+			}
+		}
+		slog.Info("downloading", "url", url, "path", filePath)
+		if err := downloadFile(ctx, url, filePath); err != nil {
+			return err
+		}
+		if err := downloadCache.Record(url, filePath); err != nil {
+			slog.Warn("update download cache", "url", url, "err", err)
+		}
+	}
+	return nil
+}
+
+type CacheEntry struct {
+	LocalPath    string    `json:"localPath"`
+	Sha256       string    `json:"sha256"`
+	DownloadTime time.Time `json:"downloadTime"`
+}
+
+type DownloadCache struct {
+	mu      sync.Mutex
+	path    string
+	Entries map[string]CacheEntry `json:"entries"`
+}
+
+var downloadCache *DownloadCache
+
+func LoadDownloadCache(FilePath string) (*DownloadCache, error) {
+	cache := &DownloadCache{path: FilePath, Entries: map[string]CacheEntry{}}
+	content, err := os.ReadFile(FilePath)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, cache); err != nil {
+		return nil, fmt.Errorf("parse download cache %s: %w", FilePath, err)
+	}
+	if cache.Entries == nil {
+		cache.Entries = map[string]CacheEntry{}
+	}
+	return cache, nil
+}
+
+func (c *DownloadCache) Lookup(url string) (CacheEntry, bool) {
+	if c == nil {
+		return CacheEntry{}, false
+	}
+	c.mu.Lock()
+	entry, ok := c.Entries[url]
+	c.mu.Unlock()
+	if !ok {
+		return CacheEntry{}, false
+	}
+	sum, err := sha256encode(entry.LocalPath)
+	if err != nil || sum != entry.Sha256 {
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *DownloadCache) Record(url, filePath string) error {
+	if c == nil {
+		return nil
+	}
+	sum, err := sha256encode(filePath)
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[url] = CacheEntry{LocalPath: absPath, Sha256: sum, DownloadTime: time.Now()}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0644)
+}
+
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	/* #nosec */
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst + ".tmp")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst + ".tmp")
+		return err
+	}
+	return os.Rename(dst+".tmp", dst)
+}
+
+const placeholderPassword = "changeme"
+
+const dockerHubServer = "https://index.docker.io/v1/"
+
+func RegistryCredentials() (types.AuthConfig, error) {
+	authConfig := types.AuthConfig{
+		Username:      config.RegistryUser,
+		Password:      config.RegistryPassword,
+		ServerAddress: dockerHubServer,
+	}
+	if user := os.Getenv("DOCKERHUB_USER"); user != "" {
+		authConfig.Username = user
+	}
+	if password := os.Getenv("DOCKERHUB_PASSWORD"); password != "" {
+		authConfig.Password = password
+	}
+	if authConfig.Password == "" || authConfig.Password == placeholderPassword {
+		fileAuth, err := dockerConfigAuth(dockerHubServer)
+		if err != nil {
+			slog.Warn("read docker config", "err", err)
+		} else if fileAuth.Password != "" {
+			authConfig = fileAuth
+		}
+	}
+	if authConfig.Password == placeholderPassword {
+		return authConfig, errors.New("registry password is still the default placeholder; set DOCKERHUB_USER/DOCKERHUB_PASSWORD or run docker login")
+	}
+	return authConfig, nil
+}
+
+func dockerConfigAuth(server string) (types.AuthConfig, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return types.AuthConfig{}, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return types.AuthConfig{}, nil
+	}
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+	var dockerConfig struct {
+		Auths map[string]types.AuthConfig `json:"auths"`
+	}
+	if err := json.Unmarshal(content, &dockerConfig); err != nil {
+		return types.AuthConfig{}, err
+	}
+	authConfig, ok := dockerConfig.Auths[server]
+	if !ok || authConfig.Auth == "" {
+		return types.AuthConfig{}, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(authConfig.Auth)
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return types.AuthConfig{}, fmt.Errorf("invalid auth entry for %s in docker config", server)
+	}
+	return types.AuthConfig{Username: parts[0], Password: parts[1], ServerAddress: server}, nil
+}
+
+func PullAnImage() error {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+
+	authConfig, err := pullCredentials()
+	if err != nil {
+		return err
+	}
+
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return err
+	}
+	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
+
+	out, err := cli.ImagePull(ctx, mirrorRef("alpine"), types.ImagePullOptions{RegistryAuth: authStr})
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+	io.Copy(os.Stdout, out)
+	opt := types.ImageBuildOptions{
+		Dockerfile: "dockerSrc/docker-debug-container/Dockerfile",
+	}
+	applyBuildResources(&opt)
+	_, err = cli.ImageBuild(ctx, nil, opt)
+	return err
+}
+
+const (
+	dockerHubRegistry  = "https://registry-1.docker.io"
+	dockerHubTokenURL  = "https://auth.docker.io/token?service=registry.docker.io&scope=repository:%s:%s"
+	ociImageIndexMedia = "application/vnd.oci.image.index.v1+json"
+)
+
+var archPlatforms = map[string]ocispec.Platform{
+	"x86_64":  {OS: "linux", Architecture: "amd64"},
+	"aarch64": {OS: "linux", Architecture: "arm64", Variant: "v8"},
+	"riscv64": {OS: "linux", Architecture: "riscv64"},
+}
+
+func platformString(platform ocispec.Platform) string {
+	s := platform.OS + "/" + platform.Architecture
+	if platform.Variant != "" {
+		s += "/" + platform.Variant
+	}
+	return s
+}
+
+var knownPlatforms = []string{
+	"linux/amd64",
+	"linux/arm64",
+	"linux/arm64/v8",
+	"linux/riscv64",
+	"linux/arm/v7",
+	"linux/ppc64le",
+	"linux/s390x",
+	"linux/386",
+}
+
+var platformOverride *ocispec.Platform
+
+func ParsePlatform(value string) (ocispec.Platform, error) {
+	for _, known := range knownPlatforms {
+		if value != known {
+			continue
+		}
+		parts := strings.Split(value, "/")
+		platform := ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+		return platform, nil
+	}
+	return ocispec.Platform{}, fmt.Errorf("unknown platform %q, want one of %s", value, strings.Join(knownPlatforms, ", "))
+}
+
+const binfmtImage = "tonistiigi/binfmt:latest"
+
+var qemuOnce sync.Once
+var qemuErr error
+
+func SetupQemuEmulation(ctx context.Context, cli *client.Client) error {
+	qemuOnce.Do(func() {
+		qemuErr = installBinfmt(ctx, cli)
+	})
+	return qemuErr
+}
+
+func mirrorRef(ref string) string {
+	if *registryMirror == "" {
+		return ref
+	}
+	return strings.TrimSuffix(*registryMirror, "/") + "/" + ref
+}
+
+func pullCredentials() (types.AuthConfig, error) {
+	if *registryMirror == "" {
+		return RegistryCredentials()
+	}
+	host := strings.SplitN(*registryMirror, "/", 2)[0]
+	authConfig, err := dockerConfigAuth(host)
+	if err != nil {
+		slog.Debug("no credentials for registry mirror, pulling anonymously", "mirror", host, "err", err)
+		return types.AuthConfig{ServerAddress: host}, nil
+	}
+	return authConfig, nil
+}
+
+func pullImage(ctx context.Context, cli *client.Client, ref string) (string, error) {
+	ref = mirrorRef(ref)
+	authConfig, err := pullCredentials()
+	if err != nil {
+		return "", err
+	}
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", err
+	}
+	out, err := cli.ImagePull(ctx, ref, types.ImagePullOptions{RegistryAuth: base64.URLEncoding.EncodeToString(encodedJSON)})
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+	_, err = io.Copy(io.Discard, out)
+	return ref, err
+}
+
+func installBinfmt(ctx context.Context, cli *client.Client) error {
+	slog.Info("registering QEMU emulators with binfmt_misc", "image", binfmtImage)
+	image, err := pullImage(ctx, cli, binfmtImage)
+	if err != nil {
+		return err
+	}
+	if _, err := runContainer(ctx, cli,
+		&container.Config{Image: image, Cmd: []string{"--install", "all"}},
+		&container.HostConfig{Privileged: true}); err != nil {
+		return fmt.Errorf("%s: %w", binfmtImage, err)
+	}
+	return nil
+}
+
+func archTag(version, arch string) string {
+	return config.TargetRepository + ":" + tagFormatter.Format(version, arch)
+}
+
+type ImageTagFormatter interface {
+	Format(version, arch string) string
+}
+
+type VersionOnlyFormatter struct{}
+
+func (VersionOnlyFormatter) Format(version, arch string) string {
+	return imageTag(version, "")
+}
+
+type VersionArchFormatter struct{}
+
+func (VersionArchFormatter) Format(version, arch string) string {
+	return imageTag(version, arch)
+}
+
+type LatestStableFormatter struct {
+	VersionArchFormatter
+}
+
+func (LatestStableFormatter) Aliases(version, arch string) []string {
+	if version != latestLTS {
+		return nil
+	}
+	if arch == "" {
+		return []string{"latest"}
+	}
+	return []string{"latest-" + arch}
+}
+
+func NewImageTagFormatter(strategy string) (ImageTagFormatter, error) {
+	switch strategy {
+	case "version-only":
+		return VersionOnlyFormatter{}, nil
+	case "version-arch":
+		return VersionArchFormatter{}, nil
+	case "latest-stable":
+		return LatestStableFormatter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown image tag strategy %q", strategy)
+	}
+}
+
+var tagFormatter ImageTagFormatter = VersionArchFormatter{}
+
+var latestLTS string
+
+func LatestLTS(OpenEulerTag []string) string {
+	versions := append([]string(nil), OpenEulerTag...)
+	SortVersions(versions)
+	for i := len(versions) - 1; i >= 0; i-- {
+		if IsLTSVersion(versions[i]) {
+			return versions[i]
+		}
+	}
+	return ""
+}
+
+type TagAliaser interface {
+	Aliases(version, arch string) []string
+}
+
+func pushAliases(ctx context.Context, registry RegistryClient, version, arch, tag string) error {
+	aliaser, ok := tagFormatter.(TagAliaser)
+	if !ok {
+		return nil
+	}
+	for _, alias := range aliaser.Aliases(version, arch) {
+		if err := CopyManifest(ctx, registry, tag, alias); err != nil {
+			return fmt.Errorf("alias %s as %s: %w", tag, alias, err)
+		}
+	}
+	return nil
+}
+
+func registryEndpoint(cfg Config) string {
+	if cfg.RegistryType == "oci" {
+		return strings.TrimSuffix(cfg.RegistryURL, "/")
+	}
+	return dockerHubRegistry
+}
+
+func CreateManifestList(ctx context.Context, cli *client.Client, registry RegistryClient, version string, archs []string) error {
+	authConfig, err := registry.AuthConfig()
+	if err != nil {
+		return err
+	}
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return err
+	}
+	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
+
+	index := ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ociImageIndexMedia,
+	}
+	for _, arch := range archs {
+		ref := registry.ImageRef(tagFormatter.Format(version, arch))
+		inspect, err := cli.DistributionInspect(ctx, ref, authStr)
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", ref, err)
+		}
+		descriptor := inspect.Descriptor
+		platform, ok := archPlatforms[arch]
+		if len(inspect.Platforms) == 1 {
+			platform = inspect.Platforms[0]
+		} else if !ok {
+			return fmt.Errorf("inspect %s: unknown platform for arch %s", ref, arch)
+		}
+		descriptor.Platform = &platform
+		index.Manifests = append(index.Manifests, descriptor)
+	}
+	body, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+
+	digest, err := putManifest(ctx, registry, imageTag(version, ""), ociImageIndexMedia, body)
+	if err != nil {
+		return err
+	}
+	slog.Info("pushed manifest list", "tag", registry.ImageRef(imageTag(version, "")), "digest", digest)
+	report.RecordPush(version, "", registry.ImageRef(imageTag(version, "")), digest)
+	if err := RecordPushedTag(imageTag(version, "")); err != nil {
+		slog.Warn("record pushed tag in state file", "path", config.StateFile, "tag", imageTag(version, ""), "err", err)
+	}
+	return nil
+}
+
+func manifestRequest(ctx context.Context, registry RegistryClient, method, reference string, header http.Header, body []byte) (*http.Response, error) {
+	authConfig, err := registry.AuthConfig()
+	if err != nil {
+		return nil, err
+	}
+	token := ""
+	if config.RegistryType != "oci" {
+		if token, err = registryToken(ctx, config.TargetRepository, "pull,push", authConfig); err != nil {
+			return nil, err
+		}
+	}
+	url := registryEndpoint(config) + "/v2/" + config.TargetRepository + "/manifests/" + reference
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res, err := httpClient(requestTimeout()).Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return res, nil
+		}
+		challenge := res.Header.Get("WWW-Authenticate")
+		res.Body.Close()
+		if token, err = ociBearerToken(ctx, challenge, authConfig); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func getManifest(ctx context.Context, registry RegistryClient, reference string) (body []byte, mediaType, digest string, err error) {
+	res, err := manifestRequest(ctx, registry, http.MethodGet, reference, http.Header{"Accept": {manifestAccept}}, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, "", "", &HTTPStatusError{URL: res.Request.URL.String(), StatusCode: res.StatusCode}
+	}
+	body, err = io.ReadAll(io.LimitReader(res.Body, 4<<20))
+	return body, res.Header.Get("Content-Type"), res.Header.Get("Docker-Content-Digest"), err
+}
+
+func putManifest(ctx context.Context, registry RegistryClient, reference, mediaType string, body []byte) (string, error) {
+	res, err := manifestRequest(ctx, registry, http.MethodPut, reference, http.Header{"Content-Type": {mediaType}}, body)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return "", fmt.Errorf("push manifest %s: %s: %s", registry.ImageRef(reference), res.Status, msg)
+	}
+	return res.Header.Get("Docker-Content-Digest"), nil
+}
+
+func CopyManifest(ctx context.Context, registry RegistryClient, src, dst string) error {
+	body, mediaType, digest, err := getManifest(ctx, registry, src)
+	if err != nil {
+		return fmt.Errorf("fetch %s: %w", registry.ImageRef(src), err)
+	}
+	if _, _, current, err := getManifest(ctx, registry, dst); err == nil && digest != "" && current == digest {
+		slog.Info("alias already points to the tag", "alias", registry.ImageRef(dst), "tag", src, "digest", digest)
+		return nil
+	}
+	if _, err := putManifest(ctx, registry, dst, mediaType, body); err != nil {
+		return err
+	}
+	slog.Info("moved alias", "alias", registry.ImageRef(dst), "tag", src, "digest", digest)
+	return nil
+}
+
+func PublishVersion(ctx context.Context, version string, archs []string) error {
+	registry, err := NewRegistryClient(config)
+	if err != nil {
+		return err
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	for _, arch := range archs {
+		dir := filepath.Join(config.WorkDir, "openEuler", version, arch)
+		if err := PushAndVerify(ctx, cli, registry, dir, archTag(version, arch), tagFormatter.Format(version, arch)); err != nil {
+			return fmt.Errorf("push %s: %w", archTag(version, arch), err)
+		}
+		if err := pushAliases(ctx, registry, version, arch, tagFormatter.Format(version, arch)); err != nil {
+			return err
+		}
+	}
+	if !*pushManifestList {
+		if aliaser, ok := tagFormatter.(TagAliaser); ok && len(aliaser.Aliases(version, "")) > 0 {
+			slog.Warn("version aliases need an image index, pass --push-manifest-list to move them", "version", version)
+		}
+		return nil
+	}
+	if err := CreateManifestList(ctx, cli, registry, version, archs); err != nil {
+		return err
+	}
+	return pushAliases(ctx, registry, version, "", imageTag(version, ""))
+}
+
+func registryToken(ctx context.Context, repository, scope string, authConfig types.AuthConfig) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(dockerHubTokenURL, repository, scope), nil)
+	if err != nil {
+		return "", err
+	}
+	if authConfig.Username != "" {
+		req.SetBasicAuth(authConfig.Username, authConfig.Password)
+	}
+	res, err := httpClient(requestTimeout()).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", &HTTPStatusError{URL: req.URL.String(), StatusCode: res.StatusCode}
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	return token.Token, nil
+}
+
+const manifestAccept = "application/vnd.oci.image.index.v1+json, application/vnd.docker.distribution.manifest.list.v2+json, application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+
+type ImageRuntimeConfig struct {
+	Cmd []string `json:"Cmd"`
+	Env []string `json:"Env"`
+}
+
+func registryGet(ctx context.Context, url, token, accept string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	res, err := httpClient(requestTimeout()).Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return &HTTPStatusError{URL: url, StatusCode: res.StatusCode}
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+func FetchImageConfig(ctx context.Context, repository, tag string) (ImageRuntimeConfig, error) {
+	token, err := registryToken(ctx, repository, "pull", types.AuthConfig{})
+	if err != nil {
+		return ImageRuntimeConfig{}, err
+	}
+	base := dockerHubRegistry + "/v2/" + repository
+	var manifest struct {
+		Config    ocispec.Descriptor   `json:"config"`
+		Manifests []ocispec.Descriptor `json:"manifests"`
+	}
+	if err := registryGet(ctx, base+"/manifests/"+tag, token, manifestAccept, &manifest); err != nil {
+		return ImageRuntimeConfig{}, err
+	}
+	if len(manifest.Manifests) > 0 {
+		digest := manifest.Manifests[0].Digest
+		for _, m := range manifest.Manifests {
+			if m.Platform != nil && m.Platform.Architecture == "amd64" {
+				digest = m.Digest
+				break
+			}
+		}
+		if err := registryGet(ctx, base+"/manifests/"+digest.String(), token, manifestAccept, &manifest); err != nil {
+			return ImageRuntimeConfig{}, err
+		}
+	}
+	var image ocispec.Image
+	if err := registryGet(ctx, base+"/blobs/"+manifest.Config.Digest.String(), token, "", &image); err != nil {
+		return ImageRuntimeConfig{}, err
+	}
+	return ImageRuntimeConfig{Cmd: image.Config.Cmd, Env: image.Config.Env}, nil
+}
+
+func DiffDockerfile(versionA, versionB string) (string, error) {
+	ctx := context.Background()
+	configA, err := FetchImageConfig(ctx, config.TargetRepository, imageTag(versionA, ""))
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", versionA, err)
+	}
+	configB, err := FetchImageConfig(ctx, config.TargetRepository, imageTag(versionB, ""))
+	if err != nil {
+		return "", fmt.Errorf("fetch %s: %w", versionB, err)
+	}
+	return unifiedDiff(targetTag(versionA), targetTag(versionB), configLines(configA), configLines(configB)), nil
+}
+
+func configLines(cfg ImageRuntimeConfig) []string {
+	cmd, _ := json.Marshal(cfg.Cmd)
+	lines := []string{"CMD " + string(cmd)}
+	for _, env := range cfg.Env {
+		lines = append(lines, "ENV "+env)
+	}
+	return lines
+}
+
+func unifiedDiff(nameA, nameB string, a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", nameA, nameB)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&sb, " %s\n", a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			fmt.Fprintf(&sb, "-%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "+%s\n", b[j])
+			j++
+		}
+	}
+	return sb.String()
+}
+
+func ListImage() error {
+	ctx := context.Background()
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+
+	images, err := cli.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		fmt.Println(image.RepoTags)
+	}
+	return nil
+}
+
+func ListImageByPrefix(ctx context.Context, cli *client.Client, prefix string) ([]types.ImageSummary, error) {
+	return cli.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", prefix+"*")),
+	})
+}
+
+type OutdatedImage struct {
+	LocalTag           string
+	LatestAvailableTag string
+}
+
+func ListOutdatedImages(ctx context.Context, cli *client.Client) ([]OutdatedImage, error) {
+	images, err := cli.ImageList(ctx, types.ImageListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	OpenEulerTag, err := GetOpenEulerTag(ctx)
+	if err != nil {
+		return nil, err
+	}
+	SortVersions(OpenEulerTag)
+	var Result []OutdatedImage
+	for _, image := range images {
+		for _, repoTag := range image.RepoTags {
+			i := strings.LastIndex(repoTag, ":")
+			if i < 0 || repoTag[:i] != config.TargetRepository {
+				continue
+			}
+			localVersion := repoTag[i+1:]
+			localKey, _, ok := parseVersion(localVersion)
+			if !ok {
+				continue
+			}
+			latest := ""
+			for _, tag := range OpenEulerTag {
+				key, _, ok := parseVersion(tag)
+				if ok && key[0] == localKey[0] && key[1] == localKey[1] && key[2] == localKey[2] && CompareVersion(tag, localVersion) > 0 {
+					latest = tag
+				}
+			}
+			if latest != "" {
+				Result = append(Result, OutdatedImage{LocalTag: repoTag, LatestAvailableTag: targetTag(latest)})
+			}
+		}
+	}
+	return Result, nil
+}
+
+var tagFilter *regexp.Regexp
+
+var sinceTime time.Time
+
+var tagTmpl *template.Template
+
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = "unknown"
+)
+
+var (
+	showVersion       = flag.Bool("version", false, "print the release tool version and exit")
+	dryRun            = flag.Bool("dry-run", false, "print the versions that would be built and exit")
+	outputFormat      = flag.String("output", "table", "dry-run output format: table or json")
+	refresh           = flag.Bool("refresh", false, "ignore the cached registry tags and query the registry")
+	logLevel          = flag.String("log-level", "info", "log level: debug, info, warn or error")
+	logFormat         = flag.String("log-format", "text", "log format: text or json")
+	latestOnly        = flag.Bool("latest-only", false, "only build the newest version that is not yet published")
+	useBuildKit       = flag.Bool("buildkit", false, "build with BuildKit, falling back to the legacy builder if unavailable")
+	forceVersion      = flag.String("force", "", "rebuild and re-push this version even if it is already published")
+	forceAll          = flag.Bool("force-all", false, "rebuild and re-push every upstream version")
+	noCleanup         = flag.Bool("no-cleanup", false, "keep downloaded artifacts after a successful push")
+	tagFilterExpr     = flag.String("tag-filter", "", "only process openEuler versions matching this regular expression")
+	listVersions      = flag.Bool("list-versions", false, "print upstream and published versions side by side and exit 1 if any need a build")
+	signKey           = flag.String("sign-key", "", "cosign key used to sign pushed images; signing is skipped if empty")
+	buildParallelism  = flag.Int("build-parallelism", 2, "number of images to build concurrently")
+	generateSBOM      = flag.Bool("sbom", false, "generate a CycloneDX SBOM next to each built image")
+	attachSBOM        = flag.Bool("sbom-attach", false, "generate an SBOM for the pushed image and attach it as an OCI referrer")
+	mirrorURL         = flag.String("mirror-url", "", "base URL of a repo.openeuler.org mirror; also disables the online releases API")
+	notifyWebhook     = flag.String("notify-webhook", "", "webhook URL (Slack/Teams compatible) to notify when the pipeline finishes")
+	notifyOn          = flag.String("notify-on", "always", "when to send the webhook: success, failure or always")
+	scanBeforePush    = flag.Bool("scan-before-push", false, "scan the image with trivy and refuse to push on findings at or above --scan-severity")
+	scanSeverity      = flag.String("scan-severity", "CRITICAL", "minimum trivy severity that blocks a push: LOW, MEDIUM, HIGH or CRITICAL")
+	whatChanged       = flag.Bool("what-changed", false, "diff the CMD and ENV of two published versions given as arguments and exit")
+	sinceExpr         = flag.String("since", "", "only process versions whose upstream directory changed after this date (RFC 3339 or YYYY-MM-DD)")
+	tagPrefix         = flag.String("tag-prefix", "", "prefix joined to the version with \"-\" in pushed tags, e.g. <prefix>-22.03-lts")
+	tagSuffix         = flag.String("tag-suffix", "", "suffix joined to the version with \"-\" in pushed tags")
+	tagTemplate       = flag.String("tag-template", "", "Go text/template for pushed tags with .Version and .Arch; overrides --tag-prefix and --tag-suffix")
+	maxVersions       = flag.Int("max-versions", 0, "build at most this many of the newest unpublished versions per run; 0 means no limit")
+	xzLevel           = flag.Int("xz-level", 6, "xz preset (0-9) used to recompress rootfs tarballs; lower is faster")
+	auditLog          = flag.String("audit-log", "", "append one JSON line per download, build and push event to this file")
+	deleteUntracked   = flag.Bool("delete-untracked", false, "delete Docker Hub version tags that no longer exist upstream and exit; honours --dry-run")
+	assumeYes         = flag.Bool("yes", false, "do not ask for confirmation before destructive actions")
+	metricsAddr       = flag.String("metrics-addr", "", "serve Prometheus metrics on this address (e.g. :9090) while the tool runs")
+	buildCPUShares    = flag.Int64("build-cpu-shares", 0, "relative CPU weight for image builds; 0 means the daemon default")
+	buildMemoryMB     = flag.Int64("build-memory-mb", 0, "memory limit for image builds in MiB; 0 means unlimited")
+	buildMemorySwapMB = flag.Int64("build-memory-swap-mb", 0, "memory plus swap limit for image builds in MiB; 0 means unlimited, -1 unlimited swap")
+	verifyOnly        = flag.Bool("verify-only", false, "check the sha256 of already-downloaded images without touching the network and exit")
+	generateNotes     = flag.Bool("generate-release-notes", false, "write Markdown release notes for the versions built in this run")
+	releaseNotesFile  = flag.String("release-notes-file", "RELEASE_NOTES.md", "file written by --generate-release-notes")
+	releaseNotesRepo  = flag.String("release-notes-github-repo", "", "owner/repo to publish the release notes to as a GitHub release (needs --github-token)")
+	noCache           = flag.Bool("no-cache", !term.IsTerminal(int(os.Stdout.Fd())), "build without the layer cache (default true when not attached to a terminal)")
+	watch             = flag.Bool("watch", false, "run the pipeline now and then again every --interval until terminated")
+	watchInterval     = flag.Duration("interval", 6*time.Hour, "time between pipeline runs in --watch mode")
+	maxDownloadSpeed  = flag.Int64("max-download-speed", 0, "cap combined download throughput in bytes per second; 0 means unlimited")
+	tagStrategy       = flag.String("image-tag-strategy", "version-arch", "per-image tag format: version-only, version-arch, or latest-stable (version-arch plus \"latest\" on the newest LTS)")
+	registryMirror    = flag.String("registry-mirror", "", "pull helper images through this registry mirror host, e.g. mirrors.example.com")
+	checkLatest       = flag.Bool("check-latest", false, "after all pushes succeed, point \"latest\" at the newest LTS version tag in the registry")
+	mirrorUser        = flag.String("mirror-user", "", "user for HTTP Basic Auth against the openEuler mirror")
+	mirrorPassword    = flag.String("mirror-password", "", "password for HTTP Basic Auth against the openEuler mirror")
+	lintDockerfile    = flag.Bool("hadolint", false, "lint the Dockerfile with hadolint and refuse to build on DL3xxx errors")
+	hadolintIgnore    = flag.String("hadolint-ignore", "", "comma-separated hadolint rules to suppress, e.g. DL3008")
+	pushRetries       = flag.Int("push-retries", 3, "attempts per image push before giving up")
+	pushBackoff       = flag.Duration("push-backoff", 2*time.Second, "base delay between push attempts, doubled each retry plus jitter")
+	buildPlatform     = flag.String("build-platform", "", "target platform for every build, e.g. linux/arm64; defaults to the arch directory or the native platform")
+	exportTagsJSON    = flag.String("export-tags-json", "", "write the versions to build and those already published to this JSON file before building")
+	rateLimitRetries  = flag.Int("rate-limit-retries", 3, "times to wait out a Docker Hub 429 (honouring Retry-After) before giving up")
+	outputDir         = flag.String("output-dir", "", "base directory for downloads, extracted images and build contexts; overrides workDir in the config")
+	buildLogFile      = flag.String("build-log", "", "also append docker build output to this file")
+	listImagesPrefix  = flag.String("list-images-prefix", "", "list local images whose reference starts with this prefix and exit")
+	squash            = flag.Bool("squash", false, "squash the built image layers into one (needs an experimental docker daemon)")
+	githubToken       = flag.String("github-token", "", "GitHub token for release notes and integrity issues (default $GITHUB_TOKEN)")
+	integrityRepo     = flag.String("integrity-issue-repo", "", "owner/repo to open a GitHub issue in when a download fails its sha256 check")
+	tagAllLTS         = flag.Bool("tag-all-lts", false, "after all pushes succeed, also point \"lts\" at the newest LTS version tag in the registry")
+	skipDownload      = flag.Bool("skip-download", false, "use the images already in the work directory and go straight to verify and build")
+	pushManifestList  = flag.Bool("push-manifest-list", false, "also push a multi-arch image index per fully built version; implies --push")
+	maxDeleteTags     = flag.Int("max-delete", 5, "refuse to delete more than this many tags in one --delete-untracked run; 0 disables the limit")
+	pushBuilt         = flag.Bool("push", false, "push and verify every arch image of each fully built version after the builds")
+	listOutdated      = flag.Bool("list-outdated", false, "list local images that have a newer service pack upstream and exit")
+)
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	for _, arg := range args {
+		if err, ok := arg.(error); ok {
+			if hint := errorHint(err); hint != "" {
+				fmt.Fprintln(os.Stderr, hint)
+			}
+		}
+	}
+	finish(true)
+	os.Exit(1)
+}
+
+var exitHooks []func(failed bool)
+
+func finish(failed bool) {
+	hooks := exitHooks
+	exitHooks = nil
+	for _, hook := range hooks {
+		hook(failed)
+	}
+}
+
+type RunReport struct {
+	mu     sync.Mutex
+	Built  []string
+	Failed []string
+	Pushed map[string]PushedImage
+}
+
+type PushedImage struct {
+	Ref    string
+	Digest string
+}
+
+func (r *RunReport) RecordPush(version, arch, ref, digest string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Pushed == nil {
+		r.Pushed = make(map[string]PushedImage)
+	}
+	r.Pushed[version+"/"+arch] = PushedImage{Ref: ref, Digest: digest}
+}
+
+func (r *RunReport) PushedImage(version, arch string) (PushedImage, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	image, ok := r.Pushed[version+"/"+arch]
+	return image, ok
+}
+
+func (r *RunReport) Record(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.Failed = append(r.Failed, name)
+	} else {
+		r.Built = append(r.Built, name)
+	}
+}
+
+var report RunReport
+
+type AuditEvent struct {
+	Time     time.Time `json:"time"`
+	Event    string    `json:"event"`
+	Version  string    `json:"version,omitempty"`
+	Arch     string    `json:"arch,omitempty"`
+	Image    string    `json:"image,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+	Digest   string    `json:"digest,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type AuditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewAuditLogger(FilePath string) (*AuditLogger, error) {
+	file, err := os.OpenFile(FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLogger{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (a *AuditLogger) Log(event AuditEvent) {
+	if a == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(event); err != nil {
+		slog.Warn("write audit log", "path", a.file.Name(), "err", err)
+	}
+}
+
+func (a *AuditLogger) Close() error {
+	if a == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+var audit *AuditLogger
+
+var (
+	downloadsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_downloads_total",
+		Help: "Image tarballs downloaded from the openEuler repo.",
+	}, []string{"version", "arch"})
+	buildsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_builds_total",
+		Help: "Images built successfully.",
+	}, []string{"version", "arch"})
+	pushesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_pushes_total",
+		Help: "Images pushed to the registry.",
+	}, []string{"version", "arch"})
+	errorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_errors_total",
+		Help: "Failed downloads, builds and pushes.",
+	}, []string{"version", "arch"})
+	durationSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "release_duration_seconds",
+		Help:    "Duration of pipeline stages.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"stage"})
+)
+
+func init() {
+	prometheus.MustRegister(downloadsTotal, buildsTotal, pushesTotal, errorsTotal, durationSeconds)
+}
+
+func ServeMetrics(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("metrics server stopped", "addr", addr, "err", err)
+		}
+	}()
+	slog.Info("serving metrics", "addr", addr)
+	return server
+}
+
+func GenerateReleaseNotes(built []string, timestamp time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# openEuler container images %s\n\n", timestamp.UTC().Format("2006-01-02"))
+	for _, version := range built {
+		var archs []string
+		for _, arch := range archsFor(version, config.Architectures) {
+			if _, ok := report.PushedImage(version, arch); ok {
+				archs = append(archs, arch)
+			}
+		}
+		index, hasIndex := report.PushedImage(version, "")
+		if len(archs) == 0 && !hasIndex {
+			continue
+		}
+		fmt.Fprintf(&b, "## %s\n\n", version)
+		if len(archs) > 0 {
+			fmt.Fprintf(&b, "Architectures: %s\n\n", strings.Join(archs, ", "))
+		}
+		b.WriteString("```\n")
+		if hasIndex {
+			fmt.Fprintf(&b, "docker pull %s\n", index.Ref)
+		} else {
+			for _, arch := range archs {
+				image, _ := report.PushedImage(version, arch)
+				fmt.Fprintf(&b, "docker pull %s\n", image.Ref)
+			}
+		}
+		b.WriteString("```\n\n")
+		b.WriteString("| Arch | Image | SHA256 digest |\n|------|-------|---------------|\n")
+		if hasIndex {
+			fmt.Fprintf(&b, "| multi-arch | `%s` | `%s` |\n", index.Ref, index.Digest)
+		}
+		for _, arch := range archs {
+			image, _ := report.PushedImage(version, arch)
+			fmt.Fprintf(&b, "| %s | `%s` | `%s` |\n", arch, image.Ref, image.Digest)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func PublishGitHubRelease(ctx context.Context, repo, tag, notes string) error {
+	if err := githubCreate(ctx, "/repos/"+repo+"/releases", map[string]string{"tag_name": tag, "name": tag, "body": notes}); err != nil {
+		return fmt.Errorf("create release %s: %w", tag, err)
+	}
+	return nil
+}
+
+type WebhookPayload struct {
+	RunID          string   `json:"runID"`
+	Timestamp      string   `json:"timestamp"`
+	VersionsBuilt  []string `json:"versionsBuilt"`
+	VersionsFailed []string `json:"versionsFailed"`
+	TotalDuration  string   `json:"totalDuration"`
+	Text           string   `json:"text"`
+}
+
+func NotifyWebhook(url string, payload WebhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	res, err := httpClient(10*time.Second).Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return &HTTPStatusError{URL: url, StatusCode: res.StatusCode}
+	}
+	return nil
+}
+
+func newRunID() string {
+	randBytes := make([]byte, 8)
+	if _, err := rand.Read(randBytes); err != nil {
+		return time.Now().UTC().Format("20060102T150405Z")
+	}
+	return hex.EncodeToString(randBytes)
+}
+
+func notifyHook(url, notifyOn string, start time.Time) func(failed bool) {
+	runID := newRunID()
+	return func(failed bool) {
+		if (failed && notifyOn == "success") || (!failed && notifyOn == "failure") {
+			return
+		}
+		status := "succeeded"
+		if failed {
+			status = "failed"
+		}
+		report.mu.Lock()
+		payload := WebhookPayload{
+			RunID:          runID,
+			Timestamp:      time.Now().UTC().Format(time.RFC3339),
+			VersionsBuilt:  append([]string{}, report.Built...),
+			VersionsFailed: append([]string{}, report.Failed...),
+			TotalDuration:  time.Since(start).Round(time.Second).String(),
+		}
+		report.mu.Unlock()
+		payload.Text = fmt.Sprintf("openEuler image release %s %s: %d built, %d failed in %s",
+			runID, status, len(payload.VersionsBuilt), len(payload.VersionsFailed), payload.TotalDuration)
+		if err := NotifyWebhook(url, payload); err != nil {
+			slog.Warn("webhook notification failed", "url", url, "err", err)
+		}
+	}
+}
+
+func setupLogger(level, format string) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, opts)))
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	return nil
+}
+
+type TagExport struct {
+	ToAdd     []string  `json:"toAdd"`
+	Existing  []string  `json:"existing"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+func ExportTagsJSON(FilePath string, toAdd, existing []string) error {
+	export := TagExport{ToAdd: toAdd, Existing: existing, Timestamp: time.Now().UTC()}
+	if export.ToAdd == nil {
+		export.ToAdd = []string{}
+	}
+	if export.Existing == nil {
+		export.Existing = []string{}
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(FilePath, append(data, '\n'), 0644)
+}
+
+func run(ctx context.Context) ([]string, error) {
+	archs := config.Architectures
+	OpenEulerTag, err := GetOpenEulerTag(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list openEuler versions: %w", err)
+	}
+	latestLTS = LatestLTS(OpenEulerTag)
+	OpenEulerTag = FilterTags(OpenEulerTag, tagFilter)
+	if !sinceTime.IsZero() {
+		OpenEulerTag, err = FilterSince(ctx, OpenEulerTag, sinceTime)
+		if err != nil {
+			return nil, fmt.Errorf("filter --since: %w", err)
+		}
+	}
+	registry, err := NewRegistryClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("create registry client: %w", err)
+	}
+	RegistryTag, err := CachedRegistryTags(ctx, registry, *refresh)
+	if err != nil {
+		return nil, fmt.Errorf("list registry tags: %w", err)
+	}
+	existing := PublishedVersions(OpenEulerTag, RegistryTag)
+	MatchResult := MatchTag(OpenEulerTag, existing)
+	if config.AliyunRepository != "" {
+		AliyunTag, err := GetAliyunMirrorTags(ctx, config.AliyunRepository)
+		if err != nil {
+			return nil, fmt.Errorf("list aliyun tags: %w", err)
+		}
+		MatchResult = MatchTag(MatchResult, PublishedVersions(MatchResult, AliyunTag))
+	}
+	MatchResult, err = ApplyForce(MatchResult, OpenEulerTag, *forceVersion, *forceAll)
+	if err != nil {
+		return nil, fmt.Errorf("apply --force: %w", err)
+	}
+	if *latestOnly && len(MatchResult) > 1 {
+		MatchResult = MatchResult[len(MatchResult)-1:]
+	}
+	if *maxVersions > 0 && len(MatchResult) > *maxVersions {
+		slog.Info("limiting versions built this run", "max", *maxVersions, "pending", len(MatchResult))
+		MatchResult = MatchResult[len(MatchResult)-*maxVersions:]
+	}
+	if *exportTagsJSON != "" {
+		if err := ExportTagsJSON(*exportTagsJSON, MatchResult, existing); err != nil {
+			return nil, fmt.Errorf("export tags: %w", err)
+		}
+	}
+	if len(MatchResult) > 0 {
+		supported, err := GetOpenEulerTagWithArch(ctx, MatchResult)
+		if err != nil {
+			slog.Warn("could not list architectures per version, assuming all are available", "err", err)
+		}
+		availableArchs = supported
+	}
+	if *dryRun {
+		if err := PrintPlan(os.Stdout, MatchResult, archs, *outputFormat); err != nil {
+			return nil, fmt.Errorf("print plan: %w", err)
+		}
+		return MatchResult, nil
+	}
+	if err := PreflightDiskCheck(config.WorkDir, int64(len(MatchResult)*len(archs))*config.AvgArchiveSizeMB); err != nil {
+		return nil, err
+	}
+	if errs := ImagePrepare(ctx, MatchResult, archs); len(errs) > 0 {
+		return nil, fmt.Errorf("%d of %d images failed to prepare: %w", len(errs), len(MatchResult)*len(archs), errors.Join(errs...))
+	}
+	errs := BuildAll(ctx, MatchResult, archs)
+	if !*noCleanup {
+		if err := CleanupPushed(config.WorkDir); err != nil {
+			return nil, errors.Join(append(errs, fmt.Errorf("clean up artifacts: %w", err))...)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d of %d images failed to build: %w", len(errs), len(MatchResult)*len(archs), errors.Join(errs...))
+	}
+	if *pushBuilt || *pushManifestList {
+		if err := UpdateAliases(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return MatchResult, nil
+}
+
+func Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report = RunReport{}
+		if err := RemoveStaleTempFiles(filepath.Join(config.WorkDir, "openEuler"), staleTempAge); err != nil {
+			slog.Warn("clean up partial downloads", "err", err)
+		}
+		start := time.Now()
+		MatchResult, err := run(context.WithoutCancel(ctx))
+		if err != nil {
+			slog.Error("pipeline run failed", "err", err, "duration", time.Since(start).Round(time.Second))
+		} else {
+			slog.Info("pipeline run finished", "versions", MatchResult, "duration", time.Since(start).Round(time.Second))
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("stopping watch mode", "reason", context.Cause(ctx))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func ListVersions(w io.Writer, OpenEulerTag []string, RegistryTag []string) (bool, error) {
+	versions := append([]string(nil), OpenEulerTag...)
+	for _, tag := range RegistryTag {
+		if !SelectStringInList(tag, versions) {
+			versions = append(versions, tag)
+		}
+	}
+	SortVersions(versions)
+	yesNo := map[bool]string{true: "yes", false: "no"}
+	complete := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tIN REPO\tIN DOCKERHUB\tNEEDS BUILD")
+	for _, version := range versions {
+		inRepo := SelectStringInList(version, OpenEulerTag)
+		inHub := SelectStringInList(version, RegistryTag)
+		needsBuild := inRepo && !inHub
+		if needsBuild {
+			complete = false
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", version, yesNo[inRepo], yesNo[inHub], yesNo[needsBuild])
+	}
+	return complete, tw.Flush()
+}
+
+func SignImage(imageRef, keyFile string) error {
+	/* #nosec */
+	cmd := exec.Command("cosign", "sign", "--key", keyFile, imageRef)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cosign sign %s: %w", imageRef, err)
+	}
+	return nil
+}
+
+const syftImage = "anchore/syft:latest"
+
+func GenerateSBOM(ctx context.Context, cli *client.Client, imageTag, outputPath string) error {
+	image, err := pullImage(ctx, cli, syftImage)
+	if err != nil {
+		return err
+	}
+	stdout, err := runContainer(ctx, cli,
+		&container.Config{Image: image, Cmd: []string{"docker:" + imageTag, "-o", "cyclonedx-json"}},
+		&container.HostConfig{Binds: []string{"/var/run/docker.sock:/var/run/docker.sock"}})
+	if err != nil {
+		return fmt.Errorf("%s: %w", syftImage, err)
+	}
+	if err := os.WriteFile(outputPath, stdout, 0644); err != nil {
+		return err
+	}
+	slog.Info("SBOM written", "image", imageTag, "path", outputPath)
+	return nil
+}
+
+func runContainer(ctx context.Context, cli *client.Client, cfg *container.Config, hostCfg *container.HostConfig) ([]byte, error) {
+	resp, err := cli.ContainerCreate(ctx, cfg, hostCfg, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer cli.ContainerRemove(context.Background(), resp.ID, types.ContainerRemoveOptions{Force: true})
+	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	var exitCode int64
+	select {
+	case err := <-errCh:
+		return nil, err
+	case status := <-statusCh:
+		exitCode = status.StatusCode
+	}
+	logs, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
+	if err != nil {
+		return nil, err
+	}
+	defer logs.Close()
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, logs); err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return stdout.Bytes(), fmt.Errorf("container exited with status %d: %s", exitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+type CVEFinding struct {
+	VulnerabilityID  string `json:"VulnerabilityID"`
+	PkgName          string `json:"PkgName"`
+	InstalledVersion string `json:"InstalledVersion"`
+	FixedVersion     string `json:"FixedVersion"`
+	Severity         string `json:"Severity"`
+	Title            string `json:"Title"`
+}
+
+var severityRank = map[string]int{"UNKNOWN": 0, "LOW": 1, "MEDIUM": 2, "HIGH": 3, "CRITICAL": 4}
+
+func ScanImage(ctx context.Context, cli *client.Client, imageTag string, severityThreshold string) ([]CVEFinding, error) {
+	threshold, ok := severityRank[strings.ToUpper(severityThreshold)]
+	if !ok {
+		return nil, fmt.Errorf("unknown severity %q", severityThreshold)
+	}
+	/* #nosec */
+	cmd := exec.CommandContext(ctx, "trivy", "image", "--quiet", "--format", "json", imageTag)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("trivy image %s: %w", imageTag, err)
+	}
+	var scan struct {
+		Results []struct {
+			Target          string       `json:"Target"`
+			Vulnerabilities []CVEFinding `json:"Vulnerabilities"`
+		} `json:"Results"`
+	}
+	if err := json.Unmarshal(out, &scan); err != nil {
+		return nil, fmt.Errorf("parse trivy output: %w", err)
+	}
+	var findings []CVEFinding
+	blocking := 0
+	for _, result := range scan.Results {
+		for _, finding := range result.Vulnerabilities {
+			findings = append(findings, finding)
+			if severityRank[strings.ToUpper(finding.Severity)] >= threshold {
+				blocking++
+			}
+		}
+	}
+	if blocking > 0 {
+		return findings, fmt.Errorf("%s has %d vulnerabilities at or above %s", imageTag, blocking, strings.ToUpper(severityThreshold))
+	}
+	return findings, nil
+}
+
+type LintIssue struct {
+	Code    string `json:"code"`
+	Level   string `json:"level"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func LintDockerfile(dockerfilePath string) ([]LintIssue, error) {
+	/* #nosec */
+	content, err := os.ReadFile(dockerfilePath)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"--format", "json", "--no-fail"}
+	for _, rule := range strings.Split(*hadolintIgnore, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			args = append(args, "--ignore", rule)
+		}
+	}
+	/* #nosec */
+	cmd := exec.Command("hadolint", append(args, "-")...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("hadolint %s: %w", dockerfilePath, err)
+	}
+	var issues []LintIssue
+	if err := json.Unmarshal(out, &issues); err != nil {
+		return nil, fmt.Errorf("parse hadolint output: %w", err)
+	}
+	blocking := 0
+	for _, issue := range issues {
+		if issue.Level == "error" && strings.HasPrefix(issue.Code, "DL3") {
+			blocking++
+		}
+	}
+	if blocking > 0 {
+		return issues, fmt.Errorf("%s has %d hadolint DL3xxx errors", dockerfilePath, blocking)
+	}
+	return issues, nil
+}
+
+func CompareDigests(ctx context.Context, cli *client.Client, localTag, remoteRef, registryAuth string) (string, bool, error) {
+	remote, err := cli.DistributionInspect(ctx, remoteRef, registryAuth)
+	if err != nil {
+		return "", false, fmt.Errorf("inspect %s: %w", remoteRef, err)
+	}
+	local, _, err := cli.ImageInspectWithRaw(ctx, localTag)
+	if err != nil {
+		return "", false, fmt.Errorf("inspect %s: %w", localTag, err)
+	}
+	repo := remoteRef
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	for _, repoDigest := range local.RepoDigests {
+		parts := strings.SplitN(repoDigest, "@", 2)
+		if len(parts) != 2 || !strings.HasSuffix(repo, parts[0]) {
+			continue
+		}
+		if parts[1] == remote.Descriptor.Digest.String() {
+			return parts[1], true, nil
+		}
+	}
+	slog.Warn("digest mismatch", "local", localTag, "localDigests", local.RepoDigests, "remote", remoteRef, "remoteDigest", remote.Descriptor.Digest)
+	return remote.Descriptor.Digest.String(), false, nil
+}
+
+func SmokeTest(ctx context.Context, cli *client.Client, imageTag string) error {
+	stdout, err := runContainer(ctx, cli,
+		&container.Config{Image: imageTag, Cmd: []string{"cat", "/etc/os-release"}},
+		&container.HostConfig{})
+	if err != nil {
+		return fmt.Errorf("smoke test %s: %w", imageTag, err)
+	}
+	if !strings.Contains(string(stdout), "openEuler") {
+		return fmt.Errorf("smoke test %s: /etc/os-release does not mention openEuler:\n%s", imageTag, stdout)
+	}
+	slog.Info("smoke test passed", "image", imageTag)
+	return nil
+}
+
+func generateSBOMFile(ctx context.Context, imageTag, outputPath string) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return GenerateSBOM(ctx, cli, imageTag, outputPath)
+}
+
+func AttachSBOM(imageRef, sbomPath string) error {
+	/* #nosec */
+	cmd := exec.Command("cosign", "attach", "sbom", "--sbom", sbomPath, "--type", "cyclonedx", imageRef)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("attach SBOM to %s: %w", imageRef, err)
+	}
+	return nil
+}
+
+type BuildTask struct {
+	Version string
+	Arch    string
+	Dir     string
+	Name    string
+}
+
+type BuildResult struct {
+	Task     BuildTask
+	Duration time.Duration
+	Err      error
+}
+
+type BuildWorkerPool struct {
+	Parallelism int
+	Build       func(ctx context.Context, dir, name string) error
+}
+
+func (p *BuildWorkerPool) Run(ctx context.Context, tasks <-chan BuildTask) []BuildResult {
+	var mu sync.Mutex
+	var results []BuildResult
+	var workers sync.WaitGroup
+	for i := 0; i < p.Parallelism; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for task := range tasks {
+				start := time.Now()
+				slog.Info("build started", "image", task.Name, "dir", task.Dir)
+				audit.Log(AuditEvent{Event: "build_started", Version: task.Version, Arch: task.Arch, Image: task.Name})
+				err := p.Build(ctx, task.Dir, task.Name)
+				result := BuildResult{Task: task, Duration: time.Since(start), Err: err}
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+		}()
+	}
+	workers.Wait()
+	return results
+}
+
+func BuildAll(ctx context.Context, MatchResult []string, archs []string) []error {
+	build := buildImage
+	if *useBuildKit {
+		build = BuildKitImagePrepare
+	}
+	pool := &BuildWorkerPool{Parallelism: *buildParallelism, Build: build}
+	tasks := make(chan BuildTask)
+	go func() {
+		defer close(tasks)
+		for _, version := range MatchResult {
+			for _, arch := range archsFor(version, archs) {
+				tasks <- BuildTask{
+					Version: version,
+					Arch:    arch,
+					Dir:     filepath.Join(config.WorkDir, "openEuler", version, arch),
+					Name:    archTag(version, arch),
+				}
+			}
+		}
+	}()
+	start := time.Now()
+	results := pool.Run(ctx, tasks)
+	var errs []error
+	failed := map[string]bool{}
+	for _, result := range results {
+		durationSeconds.WithLabelValues("build").Observe(result.Duration.Seconds())
+		if result.Err != nil {
+			failed[result.Task.Version] = true
+			errorsTotal.WithLabelValues(result.Task.Version, result.Task.Arch).Inc()
+			report.Record(result.Task.Name, result.Err)
+			errs = append(errs, &BuildError{Version: result.Task.Version, Arch: result.Task.Arch, Cause: result.Err})
+			slog.Error("build failed", "image", result.Task.Name, "duration", result.Duration.Round(time.Second), "err", result.Err)
+			continue
+		}
+		report.Record(result.Task.Name, nil)
+		buildsTotal.WithLabelValues(result.Task.Version, result.Task.Arch).Inc()
+		audit.Log(AuditEvent{Event: "build_complete", Version: result.Task.Version, Arch: result.Task.Arch, Image: result.Task.Name, Duration: result.Duration.Round(time.Millisecond).String()})
+		slog.Info("build complete", "image", result.Task.Name, "duration", result.Duration.Round(time.Second))
+		if *generateSBOM {
+			if err := generateSBOMFile(ctx, result.Task.Name, filepath.Join(result.Task.Dir, "sbom.cdx.json")); err != nil {
+				errs = append(errs, fmt.Errorf("sbom %s: %w", result.Task.Name, err))
+			}
+		}
+	}
+	slog.Info("builds finished", "total", len(results), "failed", len(errs), "duration", time.Since(start).Round(time.Second))
+	if *pushBuilt || *pushManifestList {
+		for _, version := range MatchResult {
+			if failed[version] || ctx.Err() != nil {
+				continue
+			}
+			if err := PublishVersion(ctx, version, archsFor(version, archs)); err != nil {
+				errs = append(errs, fmt.Errorf("publish %s: %w", version, err))
+			}
+		}
+	}
+	return errs
+}
+
+var pushed = struct {
+	sync.Mutex
+	archs map[string][]string
+}{archs: map[string][]string{}}
+
+func markPushed(version, arch string) {
+	pushed.Lock()
+	pushed.archs[version] = append(pushed.archs[version], arch)
+	pushed.Unlock()
+}
+
+func CleanupPushed(workDir string) error {
+	pushed.Lock()
+	defer pushed.Unlock()
+	for version, archs := range pushed.archs {
+		if err := Cleanup(workDir, []string{version}, archs); err != nil {
+			return err
+		}
+		delete(pushed.archs, version)
+	}
+	return nil
+}
+
+func Cleanup(workDir string, versions []string, archs []string) error {
+	for _, version := range versions {
+		for _, arch := range archsFor(version, archs) {
+			dir := filepath.Join(workDir, "openEuler", version, arch)
+			slog.Info("removing artifacts", "dir", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				return err
+			}
+		}
+		versionDir := filepath.Join(workDir, "openEuler", version)
+		if entries, err := os.ReadDir(versionDir); err == nil && len(entries) == 0 {
+			if err := os.Remove(versionDir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func listVersionsCommand(ctx context.Context) (bool, error) {
+	registry, err := NewRegistryClient(config)
+	if err != nil {
+		return false, err
+	}
+	RegistryTag, err := registry.ListTags(ctx, config.TargetRepository)
+	if err != nil {
+		return false, fmt.Errorf("list registry tags: %w", err)
+	}
+	OpenEulerTag, err := GetOpenEulerTag(ctx)
+	if err != nil {
+		return false, fmt.Errorf("list openEuler versions: %w", err)
+	}
+	return ListVersions(os.Stdout, OpenEulerTag, PublishedVersions(OpenEulerTag, RegistryTag))
+}
+
+func listOutdatedCommand(ctx context.Context) error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	outdated, err := ListOutdatedImages(ctx, cli)
+	if err != nil {
+		return err
+	}
+	for _, image := range outdated {
+		fmt.Printf("%s -> %s\n", image.LocalTag, image.LatestAvailableTag)
+	}
+	return nil
+}
+
+func writeReleaseNotes(ctx context.Context, MatchResult []string) error {
+	if len(report.Pushed) == 0 {
+		slog.Warn("no images were pushed in this run, skipping release notes")
+		return nil
+	}
+	now := time.Now()
+	notes := GenerateReleaseNotes(MatchResult, now)
+	if err := os.WriteFile(*releaseNotesFile, []byte(notes), 0644); err != nil {
+		return err
+	}
+	slog.Info("wrote release notes", "path", *releaseNotesFile)
+	if *releaseNotesRepo != "" {
+		tag := "images-" + now.UTC().Format("20060102-150405")
+		if err := PublishGitHubRelease(ctx, *releaseNotesRepo, tag, notes); err != nil {
+			return fmt.Errorf("publish GitHub release to %s: %w", *releaseNotesRepo, err)
+		}
+	}
+	return nil
+}
+
+func PublishImage(ctx context.Context, dir, image string) error {
+	build := buildImage
+	if *useBuildKit {
+		build = BuildKitImagePrepare
+	}
+	if err := build(ctx, dir, image); err != nil {
+		return fmt.Errorf("build image: %w", err)
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	registry, err := NewRegistryClient(config)
+	if err != nil {
+		return err
+	}
+	tag := "latest"
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		tag = image[i+1:]
+	}
+	return PushAndVerify(ctx, cli, registry, dir, image, tag)
+}
+
+func PushAndVerify(ctx context.Context, cli *client.Client, registry RegistryClient, dir, image, tag string) error {
+	ref := registry.ImageRef(tag)
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	version, arch := imageVersion(absDir), ""
+	if _, ok := archPlatforms[filepath.Base(absDir)]; ok {
+		arch = filepath.Base(absDir)
+	}
+	if *scanBeforePush {
+		findings, err := ScanImage(ctx, cli, image, *scanSeverity)
+		for _, finding := range findings {
+			slog.Warn("vulnerability", "id", finding.VulnerabilityID, "package", finding.PkgName, "severity", finding.Severity)
+		}
+		if err != nil {
+			return fmt.Errorf("scan image: %w", err)
+		}
+	}
+	audit.Log(AuditEvent{Event: "push_started", Image: ref})
+	pushStart := time.Now()
+	if err := registry.PushImage(ctx, image, tag); err != nil {
+		errorsTotal.WithLabelValues(version, arch).Inc()
+		audit.Log(AuditEvent{Event: "push_failed", Image: ref, Duration: time.Since(pushStart).Round(time.Millisecond).String(), Error: err.Error()})
+		return err
+	}
+	pushesTotal.WithLabelValues(version, arch).Inc()
+	durationSeconds.WithLabelValues("push").Observe(time.Since(pushStart).Seconds())
+	if filepath.Dir(filepath.Dir(absDir)) == filepath.Join(config.WorkDir, "openEuler") {
+		markPushed(version, filepath.Base(absDir))
+	}
+	pushed, _, err := cli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("inspect pushed image: %w", err)
+	}
+	audit.Log(AuditEvent{Event: "push_complete", Image: ref, Duration: time.Since(pushStart).Round(time.Millisecond).String(), Digest: strings.Join(pushed.RepoDigests, ",")})
+	authConfig, err := registry.AuthConfig()
+	if err != nil {
+		return err
+	}
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return err
+	}
+	digest, match, err := CompareDigests(ctx, cli, image, ref, base64.URLEncoding.EncodeToString(encodedJSON))
+	if err != nil {
+		return fmt.Errorf("verify pushed digest: %w", err)
+	} else if !match {
+		return errors.New("pushed digest does not match the local image")
+	}
+	report.RecordPush(version, arch, ref, digest)
+	if err := RecordPushedTag(tag); err != nil {
+		slog.Warn("record pushed tag in state file", "path", config.StateFile, "tag", tag, "err", err)
+	}
+	if err := SmokeTest(ctx, cli, ref); err != nil {
+		return fmt.Errorf("smoke test: %w", err)
+	}
+	if *attachSBOM {
+		sbomPath := filepath.Join(dir, "sbom.cdx.json")
+		if err := generateSBOMFile(ctx, ref, sbomPath); err != nil {
+			return fmt.Errorf("generate SBOM: %w", err)
+		}
+		if err := AttachSBOM(ref, sbomPath); err != nil {
+			return fmt.Errorf("attach SBOM: %w", err)
+		}
+	}
+	if *signKey != "" {
+		if err := SignImage(ref, *signKey); err != nil {
+			return fmt.Errorf("sign image: %w", err)
+		}
+	}
+	return nil
+}
+
+type Command struct {
+	Name  string
+	Usage string
+	Flags *flag.FlagSet
+	Run   func(ctx context.Context, args []string) error
+}
+
+func newCommand(name, usage string, run func(ctx context.Context, args []string) error) *Command {
+	cmd := &Command{Name: name, Usage: usage, Flags: flag.NewFlagSet(name, flag.ExitOnError), Run: run}
+	cmd.Flags.Usage = func() {
+		fmt.Fprintf(cmd.Flags.Output(), "usage: %s [global flags] %s\n", filepath.Base(os.Args[0]), cmd.Usage)
+		cmd.Flags.PrintDefaults()
+	}
+	return cmd
+}
+
+var commands = map[string]*Command{}
+
+func init() {
+	build := newCommand("build", "build [flags]\n\nDownload, verify and build every openEuler version not yet published.", func(ctx context.Context, args []string) error {
+		if err := RemoveStaleTempFiles(filepath.Join(config.WorkDir, "openEuler"), staleTempAge); err != nil {
+			slog.Warn("clean up partial downloads", "err", err)
+		}
+		MatchResult, err := run(ctx)
+		if err != nil || *dryRun {
+			return err
+		}
+		if *generateNotes && len(MatchResult) > 0 {
+			return writeReleaseNotes(ctx, MatchResult)
+		}
+		return nil
+	})
+	build.Flags.BoolVar(dryRun, "dry-run", *dryRun, "print the versions that would be built and exit")
+	build.Flags.BoolVar(latestOnly, "latest-only", *latestOnly, "only build the newest version that is not yet published")
+	build.Flags.IntVar(maxVersions, "max-versions", *maxVersions, "build at most this many of the newest unpublished versions")
+	build.Flags.StringVar(forceVersion, "force", *forceVersion, "rebuild this version even if it is already published")
+	build.Flags.BoolVar(generateNotes, "generate-release-notes", *generateNotes, "write Markdown release notes for the built versions")
+	build.Flags.BoolVar(pushBuilt, "push", *pushBuilt, "push and verify every arch image of each fully built version")
+	build.Flags.BoolVar(pushManifestList, "push-manifest-list", *pushManifestList, "also push a multi-arch image index per version; implies --push")
+	build.Flags.BoolVar(scanBeforePush, "scan-before-push", *scanBeforePush, "scan each image with trivy before pushing it")
+	build.Flags.StringVar(signKey, "sign-key", *signKey, "cosign key used to sign each pushed image")
+
+	push := newCommand("push", "push [flags] <dir> <image>\n\nBuild the image in <dir>, push it as <image> and verify the result.", func(ctx context.Context, args []string) error {
+		if len(args) != 2 {
+			return errors.New("push needs two arguments: <dir> <image>")
+		}
+		if (*checkLatest || *tagAllLTS) && latestLTS == "" {
+			OpenEulerTag, err := GetOpenEulerTag(ctx)
+			if err != nil {
+				return fmt.Errorf("list openEuler versions: %w", err)
+			}
+			latestLTS = LatestLTS(OpenEulerTag)
+		}
+		if err := PublishImage(ctx, args[0], args[1]); err != nil {
+			return err
+		}
+		if err := UpdateAliases(ctx); err != nil {
+			return err
+		}
+		if *noCleanup {
+			return nil
+		}
+		return CleanupPushed(config.WorkDir)
+	})
+	push.Flags.BoolVar(scanBeforePush, "scan-before-push", *scanBeforePush, "scan the image with trivy before pushing")
+	push.Flags.StringVar(signKey, "sign-key", *signKey, "cosign key used to sign the pushed image")
+	push.Flags.BoolVar(checkLatest, "check-latest", *checkLatest, "move latest to the newest LTS after the push succeeds")
+	push.Flags.BoolVar(tagAllLTS, "tag-all-lts", *tagAllLTS, "also move lts to the newest LTS after the push succeeds")
+
+	verify := newCommand("verify", "verify\n\nCheck the sha256 of every downloaded image without touching the network.", func(ctx context.Context, args []string) error {
+		ok, err := VerifyDownloads(ctx, os.Stdout, config.WorkDir)
+		if err == nil && !ok {
+			err = errors.New("some downloads failed verification")
+		}
+		return err
+	})
+
+	clean := newCommand("clean", "clean [version...]\n\nRemove downloaded artifacts for the given versions, or for every version.", func(ctx context.Context, args []string) error {
+		versions := args
+		if len(versions) == 0 {
+			dirs, err := filepath.Glob(filepath.Join(config.WorkDir, "openEuler", "*"))
+			if err != nil {
+				return err
+			}
+			for _, dir := range dirs {
+				versions = append(versions, filepath.Base(dir))
+			}
+		}
+		return Cleanup(config.WorkDir, versions, config.Architectures)
+	})
+
+	var outdated bool
+	list := newCommand("list", "list [flags]\n\nShow upstream and published versions side by side.", func(ctx context.Context, args []string) error {
+		if outdated {
+			return listOutdatedCommand(ctx)
+		}
+		complete, err := listVersionsCommand(ctx)
+		if err == nil && !complete {
+			err = errors.New("some versions need a build")
+		}
+		return err
+	})
+	list.Flags.BoolVar(&outdated, "outdated", false, "list local images that have a newer service pack upstream instead")
+
+	for _, cmd := range []*Command{build, push, verify, clean, list} {
+		commands[cmd.Name] = cmd
+	}
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "usage: %s [global flags] <command> [flags] [args]\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(out, "       %s [global flags] <dir> <image>\n\ncommands:\n", filepath.Base(os.Args[0]))
+		for _, name := range []string{"build", "push", "verify", "clean", "list"} {
+			fmt.Fprintf(out, "  %-8s %s\n", name, strings.SplitN(commands[name].Usage, "\n\n", 2)[1])
+		}
+		fmt.Fprintf(out, "\nRun '%s <command> -h' for command flags.\n\nglobal flags:\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
 	}
 }
 
-func GetDockerHubTag() []string {
-	url := "https://hub.docker.com/v2/repositories/openeuler2k8s/openeuler/tags"
-	method := "GET"
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		panic(err)
+func main() {
+	configPath := flag.String("config", os.Getenv("RELEASE_CONFIG"), "path to the JSON config file (default "+defaultConfigFile+", or $RELEASE_CONFIG)")
+	flag.Var(extraLabels, "labels", "extra image label as key=value; repeat for more labels")
+	flag.Var(&skipArchs, "skip-arch", "architecture to leave out of this run, e.g. aarch64; repeat for more")
+	flag.Parse()
+	if *showVersion {
+		fmt.Printf("version: %s\ncommit: %s\nbuild date: %s\n", version, commit, buildDate)
+		return
+	}
+	if err := setupLogger(*logLevel, *logFormat); err != nil {
+		fatal("configure logging", "err", err)
+	}
+	switch *notifyOn {
+	case "success", "failure", "always":
+	default:
+		fatal("invalid --notify-on", "value", *notifyOn)
+	}
+	if *notifyWebhook != "" {
+		exitHooks = append(exitHooks, notifyHook(*notifyWebhook, *notifyOn, time.Now()))
+	}
+	if *metricsAddr != "" {
+		server := ServeMetrics(*metricsAddr)
+		exitHooks = append(exitHooks, func(bool) {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		})
+	}
+	if *auditLog != "" {
+		logger, err := NewAuditLogger(*auditLog)
+		if err != nil {
+			fatal("open audit log", "path", *auditLog, "err", err)
+		}
+		audit = logger
+		exitHooks = append(exitHooks, func(bool) { _ = audit.Close() })
+	}
+	if *buildLogFile != "" {
+		/* #nosec */
+		f, err := os.OpenFile(*buildLogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fatal("open build log", "path", *buildLogFile, "err", err)
+		}
+		buildLog.w = io.MultiWriter(os.Stdout, f)
+		exitHooks = append(exitHooks, func(bool) { _ = f.Close() })
+	}
+	if *buildPlatform != "" {
+		platform, err := ParsePlatform(*buildPlatform)
+		if err != nil {
+			fatal("invalid --build-platform", "err", err)
+		}
+		platformOverride = &platform
+	}
+	if *xzLevel < 0 || *xzLevel > 9 {
+		fatal("--xz-level must be between 0 and 9", "value", *xzLevel)
 	}
-	res, err := client.Do(req)
+	if *buildCPUShares < 0 || *buildMemoryMB < 0 || *buildMemorySwapMB < -1 {
+		fatal("--build-cpu-shares, --build-memory-mb and --build-memory-swap-mb must not be negative")
+	}
+	if *buildMemoryMB > 0 && *buildMemorySwapMB > 0 && *buildMemoryMB > *buildMemorySwapMB {
+		fatal("--build-memory-mb must not exceed --build-memory-swap-mb", "memory", *buildMemoryMB, "memorySwap", *buildMemorySwapMB)
+	}
+	if *maxDownloadSpeed < 0 {
+		fatal("--max-download-speed must not be negative")
+	}
+	if *maxDownloadSpeed > 0 {
+		burst := 32 << 10
+		if int64(burst) > *maxDownloadSpeed {
+			burst = int(*maxDownloadSpeed)
+		}
+		downloadLimiter = rate.NewLimiter(rate.Limit(*maxDownloadSpeed), burst)
+	}
+	if *maxVersions < 0 {
+		fatal("--max-versions must not be negative")
+	}
+	if *pushRetries < 1 {
+		fatal("--push-retries must be at least 1")
+	}
+	if *rateLimitRetries < 0 {
+		fatal("--rate-limit-retries must not be negative")
+	}
+	if *watch && *watchInterval <= 0 {
+		fatal("--interval must be positive")
+	}
+	if *buildParallelism < 1 {
+		fatal("--build-parallelism must be at least 1")
+	}
+	if *tagFilterExpr != "" {
+		re, err := regexp.Compile(*tagFilterExpr)
+		if err != nil {
+			fatal("invalid --tag-filter", "expr", *tagFilterExpr, "err", err)
+		}
+		tagFilter = re
+	}
+	formatter, err := NewImageTagFormatter(*tagStrategy)
 	if err != nil {
-		panic(err)
+		fatal("invalid --image-tag-strategy", "err", err)
 	}
-	defer res.Body.Close()
-	body, err := ioutil.ReadAll(res.Body)
+	tagFormatter = formatter
+	if *tagTemplate != "" {
+		tmpl, err := template.New("tag").Option("missingkey=error").Parse(*tagTemplate)
+		if err != nil {
+			fatal("invalid --tag-template", "template", *tagTemplate, "err", err)
+		}
+		if err := tmpl.Execute(io.Discard, TagFields{Version: "22.03-lts", Arch: "x86_64"}); err != nil {
+			fatal("invalid --tag-template", "template", *tagTemplate, "err", err)
+		}
+		tagTmpl = tmpl
+	}
+	if *sinceExpr != "" {
+		t, err := ParseSince(*sinceExpr)
+		if err != nil {
+			fatal("invalid --since, expected RFC 3339 or YYYY-MM-DD", "value", *sinceExpr, "err", err)
+		}
+		sinceTime = t
+	}
+	if *configPath == "" {
+		*configPath = defaultConfigFile
+	}
+	cfg, err := LoadConfig(*configPath)
 	if err != nil {
-		panic(err)
+		fatal("load config", "err", err)
+	}
+	config = cfg
+	if *mirrorURL != "" {
+		config.SourceBaseURL = strings.TrimSuffix(*mirrorURL, "/") + "/"
+		config.ReleasesAPIURL = ""
+		slog.Info("using openEuler mirror", "url", config.SourceBaseURL)
+	}
+
+	if len(skipArchs) > 0 {
+		archs, err := SkipArchs(config.Architectures, skipArchs)
+		if err != nil {
+			fatal("invalid --skip-arch", "err", err)
+		}
+		config.Architectures = archs
+	}
+	if _, ok := tagFormatter.(VersionOnlyFormatter); ok && len(config.Architectures) > 1 {
+		fatal("--image-tag-strategy version-only gives every arch the same tag, select a single arch or use version-arch with --push-manifest-list", "architectures", config.Architectures)
 	}
-	var DockerHubTag DockerHubTag
-	err = json.Unmarshal(body, &DockerHubTag)
+	if *outputDir != "" {
+		config.WorkDir = *outputDir
+	}
+	if err := os.MkdirAll(config.WorkDir, 0755); err != nil {
+		fatal("create output directory", "path", config.WorkDir, "err", err)
+	}
+	workDir, err := filepath.Abs(config.WorkDir)
 	if err != nil {
-		panic(err)
+		fatal("resolve output directory", "path", config.WorkDir, "err", err)
 	}
-	var Tag []string
-	for i := 0; i < len(DockerHubTag.Results); i++ {
-		if DockerHubTag.Results[i].Name != "latest" {
-			Tag = append(Tag, DockerHubTag.Results[i].Name)
+	config.WorkDir = workDir
+	slog.Info("using output directory", "path", config.WorkDir)
+	if config.DownloadCacheFile != "" {
+		cache, err := LoadDownloadCache(config.DownloadCacheFile)
+		if err != nil {
+			fatal("load download cache", "err", err)
 		}
+		downloadCache = cache
 	}
-	return Tag
-}
 
-func SelectStringInList(SrcString string, DestinationTag []string) bool {
-	for i := 0; i < len(DestinationTag); i++ {
-		if DestinationTag[i] == SrcString {
-			return true
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		signal.Stop(signals)
+		cancel(&InterruptError{Signal: sig})
+	}()
+
+	if *whatChanged {
+		if flag.NArg() != 2 {
+			fatal("--what-changed needs two arguments: <old-version> <new-version>")
+		}
+		diff, err := DiffDockerfile(flag.Arg(0), flag.Arg(1))
+		if err != nil {
+			fatal("diff versions", "err", err)
 		}
+		fmt.Print(diff)
+		return
 	}
-	return false
-}
 
-func MatchTag(SourceTag []string, DestinationTag []string) []string {
-	var Result []string
-	for i := 0; i < len(SourceTag); i++ {
-		if SelectStringInList(SourceTag[i], DestinationTag) {
-			continue
-		} else {
-			Result = append(Result, SourceTag[i])
+	if *listVersions {
+		complete, err := listVersionsCommand(ctx)
+		if err != nil {
+			fatal("list versions", "err", err)
+		}
+		if !complete {
+			os.Exit(1)
 		}
+		return
 	}
-	return Result
-}
 
-func PathExists(path string) (bool, error) {
-	_, err := os.Stat(path)
-	if err == nil {
-		return true, nil
+	if *verifyOnly {
+		ok, err := VerifyDownloads(ctx, os.Stdout, config.WorkDir)
+		if err != nil {
+			fatal("verify downloads", "err", err)
+		}
+		if !ok {
+			finish(true)
+			os.Exit(1)
+		}
+		return
 	}
-	if os.IsNotExist(err) {
-		return false, nil
+	if *deleteUntracked {
+		if config.RegistryType != "dockerhub" {
+			fatal("--delete-untracked only supports the dockerhub registry type", "registryType", config.RegistryType)
+		}
+		OpenEulerTag, err := GetOpenEulerTag(ctx)
+		if err != nil {
+			fatal("list openEuler versions", "err", err)
+		}
+		hubTags, err := GetDockerHubTag(ctx, config.TargetRepository)
+		if err != nil {
+			fatal("list registry tags", "err", err)
+		}
+		deleted, err := DeleteUntrackedTags(ctx, hubTags, OpenEulerTag, *dryRun)
+		for _, tag := range deleted {
+			fmt.Println(config.TargetRepository + ":" + tag)
+		}
+		if err != nil {
+			fatal("delete untracked tags", "err", err)
+		}
+		return
+	}
+	if *listImagesPrefix != "" {
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			fatal("create docker client", "err", err)
+		}
+		images, err := ListImageByPrefix(ctx, cli, *listImagesPrefix)
+		cli.Close()
+		if err != nil {
+			fatal("list images", "prefix", *listImagesPrefix, "err", err)
+		}
+		for _, image := range images {
+			for _, tag := range image.RepoTags {
+				fmt.Println(tag)
+			}
+		}
+		return
+	}
+	if *listOutdated {
+		if err := listOutdatedCommand(ctx); err != nil {
+			fatal("list outdated images", "err", err)
+		}
+		return
 	}
-	return false, err
-}
 
-func sha256encode(FilePath string) string {
-	f, err := os.Open(FilePath)
+	if *watch {
+		Watch(ctx, *watchInterval)
+		finish(false)
+		return
+	}
+	if flag.NArg() > 0 {
+		if cmd, ok := commands[flag.Arg(0)]; ok {
+			if err := cmd.Flags.Parse(flag.Args()[1:]); err != nil {
+				fatal("parse flags", "command", cmd.Name, "err", err)
+			}
+			if err := cmd.Run(ctx, cmd.Flags.Args()); err != nil {
+				if ctx.Err() != nil {
+					gracefulShutdown(ctx)
+				}
+				fatal(cmd.Name+" failed", "err", err)
+			}
+			finish(false)
+			return
+		}
+	}
+	if err := RemoveStaleTempFiles(filepath.Join(config.WorkDir, "openEuler"), staleTempAge); err != nil {
+		slog.Warn("clean up partial downloads", "err", err)
+	}
+	MatchResult, err := run(ctx)
+	if err != nil && ctx.Err() != nil {
+		gracefulShutdown(ctx)
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal("release failed", "err", err)
 	}
-	defer f.Close()
-
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
-		log.Fatal(err)
+	if *dryRun {
+		return
 	}
-	result := h.Sum(nil)
-	hex_string_data := hex.EncodeToString(result)
-	return hex_string_data
+	// PullAnImage()
+	if flag.NArg() != 2 {
+		finish(false)
+		fmt.Println("bad num of arguments:\n\t1. = dir with image content\n\t2. = image name")
+		os.Exit(0)
+	}
+	if err := PublishImage(ctx, flag.Arg(0), flag.Arg(1)); err != nil {
+		fatal("publish image", "image", flag.Arg(1), "err", err)
+	}
+	if err := UpdateAliases(ctx); err != nil {
+		fatal("update aliases", "err", err)
+	}
+	if *generateNotes && len(MatchResult) > 0 {
+		if err := writeReleaseNotes(ctx, MatchResult); err != nil {
+			fatal("release notes", "err", err)
+		}
+	}
+	if !*noCleanup {
+		if err := CleanupPushed(config.WorkDir); err != nil {
+			fatal("clean up artifacts", "err", err)
+		}
+	}
+	finish(false)
 }
 
-func ReadFile(FilePath string) string {
-	content, err := os.ReadFile(FilePath)
+func createTar(srcDir, tarFIle string) (err error) {
+	file, err := os.Create(tarFIle)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(tarFIle)
+		}
+	}()
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	err = filepath.Walk(srcDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(filePath); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		/* #nosec */
+		f, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
 	}
-	return string(content)[0:64]
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return file.Close()
 }
 
-func ExecCommand(Command string) string {
-	fmt.Println(Command)
-	cmd := exec.Command("/bin/bash", "-c", Command)
-	out, err := cmd.Output()
-	if err != nil {
-		fmt.Println(err)
+func tempFileName(prefix, suffix string) (string, error) {
+	randBytes := make([]byte, 16)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", err
 	}
-	return string(out)
+
+	return filepath.Join(os.TempDir(), prefix+hex.EncodeToString(randBytes)+suffix), nil
 }
 
-func ImagePrepare(MatchResult []string, archs []string) {
-	pwd, _ := os.Getwd()
-	for i := 0; i < len(MatchResult); i++ {
-		for j := 0; j < len(archs); j++ {
-			version := MatchResult[i]
-			BasicURL := "https://repo.openeuler.org/openEuler-" + strings.ToUpper(version) + "/docker_img/"
-			dir := filepath.Join(pwd, "openEuler", MatchResult[i], archs[j])
-			err := os.MkdirAll(dir, 0766)
-			if err != nil {
-				fmt.Println(err)
-			}
-			imageFile := "openEuler-docker." + archs[j] + ".tar.xz"
-			rootfsFile := "openEuler-docker-rootfs." + archs[j] + ".tar"
-			sha256sumFile := "openEuler-docker." + archs[j] + ".tar.xz.sha256sum"
-			imagePath := filepath.Join(dir, imageFile)
-			sha256sumPath := filepath.Join(dir, sha256sumFile)
-			rootfsPath := filepath.Join(dir, rootfsFile)
-			isExist, err := PathExists(imagePath)
-			if err != nil {
-				panic(err)
-			}
-			if !isExist {
-				url := BasicURL + archs[j] + "/" + imageFile
-				fmt.Println(url)
-				wg.Add(1)
-				downloadFile(url, imagePath)
-			}
-			isExist, err = PathExists(sha256sumPath)
-			if err != nil {
-				panic(err)
-			}
-			if !isExist {
-				url := BasicURL + archs[j] + "/" + sha256sumFile
-				wg.Add(1)
-				downloadFile(url, sha256sumPath)
-			}
-			wg.Wait()
-			SrcSha256 := sha256encode(imagePath)
-			DestSha256 := ReadFile(sha256sumPath)
-			if SrcSha256 != DestSha256 {
-				panic("Sha256 Sum Error.")
-			}
-			isExist, err = PathExists(rootfsPath)
-			if err != nil {
-				panic(err)
-			}
-			sysType := runtime.GOOS
-			if sysType != "linux" {
-				panic("Only Linux Run.")
-			}
-			if !isExist {
-				os.Chdir(dir)
-				Command := "tar -xf openEuler-docker." + archs[j] + ".tar.xz --wildcards '*.tar' --exclude 'layer.tar'"
-				result := ExecCommand(Command)
-				fmt.Println(result)
-				Command = "ls | xargs -n1 | grep -v openEuler |grep *.tar"
-				result = ExecCommand(Command)
-				fmt.Println(result)
-				arr := strings.Split(result, "\n")
-				fmt.Println(arr)
-				tarFileName := arr[0]
-				Command = "mv " + tarFileName + " openEuler-docker-rootfs." + archs[j] + ".tar"
-				result = ExecCommand(Command)
-				fmt.Println(result)
-				Command = "xz -z openEuler-docker-rootfs." + archs[j] + ".tar"
-				result = ExecCommand(Command)
-				fmt.Println(result)
-				Command = "cp " + pwd + "/Dockerfile " + dir + "/Dockerfile"
-				result = ExecCommand(Command)
-				fmt.Println(result)
-			}
-		}
-	}
-}
-
-func PullAnImage() {
-	ctx := context.Background()
+type lineWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lineWriter) WriteLine(line []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = l.w.Write(append(append([]byte(nil), line...), '\n'))
+}
+
+var buildLog = &lineWriter{w: os.Stdout}
+
+func buildImage(ctx context.Context, dir, name string) error {
+	return buildImageWith(ctx, dir, name, types.BuilderV1)
+}
+
+func BuildKitImagePrepare(ctx context.Context, dir, name string) error {
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
-		panic(err)
-	}
-
-	authConfig := types.AuthConfig{
-		Username: "openeuler2k8s",
-		Password: "changeme",
+		return err
 	}
-
-	encodedJSON, err := json.Marshal(authConfig)
+	ping, err := cli.Ping(ctx)
+	cli.Close()
 	if err != nil {
-		panic(err)
+		return err
 	}
-	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
+	if ping.OSType == "windows" || versions.LessThan(ping.APIVersion, "1.39") {
+		slog.Warn("BuildKit is not available, falling back to the legacy builder", "apiVersion", ping.APIVersion, "osType", ping.OSType)
+		return buildImage(ctx, dir, name)
+	}
+	return buildImageWith(ctx, dir, name, types.BuilderBuildKit)
+}
 
-	out, err := cli.ImagePull(ctx, "alpine", types.ImagePullOptions{RegistryAuth: authStr})
+func DockerfileArgs(FilePath string) ([]string, error) {
+	content, err := os.ReadFile(FilePath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-
-	defer out.Close()
-	io.Copy(os.Stdout, out)
-	opt := types.ImageBuildOptions{
-		CPUSetCPUs:   "2",
-		CPUSetMems:   "12",
-		CPUShares:    20,
-		CPUQuota:     10,
-		CPUPeriod:    30,
-		Memory:       256,
-		MemorySwap:   512,
-		ShmSize:      10,
-		CgroupParent: "cgroup_parent",
-		Dockerfile:   "dockerSrc/docker-debug-container/Dockerfile",
+	var Result []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "ARG") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			Result = append(Result, strings.SplitN(field, "=", 2)[0])
+		}
 	}
-	cli.ImageBuild(ctx, nil, opt)
+	return Result, nil
 }
 
-func ListImage() {
-	ctx := context.Background()
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+func BuildArgs(dir string) (map[string]*string, error) {
+	declared, err := DockerfileArgs(filepath.Join(dir, "Dockerfile"))
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	arch := filepath.Base(dir)
+	values := map[string]string{
+		"OPENEULER_VERSION": imageVersion(dir),
+		"OPENEULER_ARCH":    arch,
+		"BUILD_DATE":        time.Now().UTC().Format(time.RFC3339),
 	}
+	buildArgs := make(map[string]*string)
+	for _, name := range declared {
+		if value, ok := values[name]; ok {
+			buildArgs[name] = &value
+		}
+	}
+	return buildArgs, nil
+}
 
-	images, err := cli.ImageList(ctx, types.ImageListOptions{})
-	if err != nil {
-		panic(err)
+func applyBuildResources(opt *types.ImageBuildOptions) {
+	opt.CPUShares = *buildCPUShares
+	opt.Memory = *buildMemoryMB << 20
+	opt.MemorySwap = *buildMemorySwapMB
+	if *buildMemorySwapMB > 0 {
+		opt.MemorySwap = *buildMemorySwapMB << 20
 	}
+}
 
-	for _, image := range images {
-		fmt.Println(image.RepoTags)
+const sourceRepository = "https://gitee.com/abuxliu/intern-container-basic-image-release"
+
+func ImageLabels(openEulerVersion string) map[string]string {
+	labels := map[string]string{
+		"org.opencontainers.image.created":   time.Now().UTC().Format(time.RFC3339),
+		"org.opencontainers.image.source":    sourceRepository,
+		"org.opencontainers.image.revision":  commit,
+		"org.opencontainers.image.version":   openEulerVersion,
+		"org.opencontainers.image.vendor":    "openEuler",
+		"org.openeuler.release.tool.version": version,
+		"org.openeuler.release.tool.created": buildDate,
 	}
+	for key, value := range extraLabels {
+		labels[key] = value
+	}
+	return labels
+}
+
+type stringsFlag []string
+
+var skipArchs stringsFlag
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
 }
 
-func run() {
-	var archs []string
-	archs = append(archs, "x86_64")
-	archs = append(archs, "aarch64")
-	OpenEulerTag := GetOpenEulerTag()
-	DockerHubTag := GetDockerHubTag()
-	MatchResult := MatchTag(OpenEulerTag, DockerHubTag)
-	ImagePrepare(MatchResult, archs)
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
 }
 
-func main() {
-	run()
-	// PullAnImage()
-	if len(os.Args) != 3 {
-		fmt.Println("bad num of arguments:\n\t1. = dir with image content\n\t2. = image name")
-		os.Exit(0)
+func SkipArchs(archs, skip []string) ([]string, error) {
+	skipped := make(map[string]bool, len(skip))
+	for _, arch := range skip {
+		if _, ok := archPlatforms[arch]; !ok {
+			return nil, fmt.Errorf("unknown architecture %q", arch)
+		}
+		skipped[arch] = true
 	}
-
-	msg, err := buildImage(os.Args[1], os.Args[2])
-	if err != nil {
-		log.Fatal(err)
+	var Result []string
+	for _, arch := range archs {
+		if !skipped[arch] {
+			Result = append(Result, arch)
+		}
+	}
+	if len(Result) == 0 {
+		return nil, errors.New("no architectures left to build")
 	}
+	return Result, nil
+}
+
+var labelKey = regexp.MustCompile(`^[a-z0-9]+([.-][a-z0-9]+)*$`)
 
-	fmt.Println(msg)
+type labelFlags map[string]string
+
+var extraLabels = labelFlags{}
+
+func (l labelFlags) String() string {
+	pairs := make([]string, 0, len(l))
+	for key, value := range l {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
 }
 
-func createTar(srcDir, tarFIle string) error {
-	/* #nosec */
-	c := exec.Command("tar", "-cf", tarFIle, "-C", srcDir, ".")
-	if err := c.Run(); err != nil {
-		return nil
+func (l labelFlags) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("label %q is not key=value", value)
+	}
+	if !labelKey.MatchString(key) {
+		return fmt.Errorf("label key %q must be lowercase alphanumerics separated by single dots or hyphens", key)
 	}
+	l[key] = val
 	return nil
 }
 
-func tempFileName(prefix, suffix string) (string, error) {
-	randBytes := make([]byte, 16)
-	if _, err := rand.Read(randBytes); err != nil {
-		return "", err
+func imageVersion(dir string) string {
+	if _, ok := archPlatforms[filepath.Base(dir)]; ok {
+		return filepath.Base(filepath.Dir(dir))
 	}
-
-	return filepath.Join(os.TempDir(), prefix+hex.EncodeToString(randBytes)+suffix), nil
+	return filepath.Base(dir)
 }
 
-func buildImage(dir, name string) ([]string, error) {
+func buildImageWith(ctx context.Context, dir, name string, builder types.BuilderVersion) error {
+
+	if config.PreBuildHook.Command != "" {
+		if err := RunPreBuildHook(ctx, config.PreBuildHook, dir); err != nil {
+			return err
+		}
+	}
+	if *lintDockerfile {
+		issues, err := LintDockerfile(filepath.Join(dir, "Dockerfile"))
+		for _, issue := range issues {
+			slog.Warn("hadolint", "code", issue.Code, "level", issue.Level, "line", issue.Line, "message", issue.Message)
+		}
+		if err != nil {
+			return err
+		}
+	}
 
 	tarFile, err := tempFileName("docker-", ".image")
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer os.Remove(tarFile)
 
 	if err := createTar(dir, tarFile); err != nil {
-		return nil, err
+		return err
 	}
 
 	/* #nosec */
 	dockerFileTarReader, err := os.Open(tarFile)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer dockerFileTarReader.Close()
 
 	cli, err := client.NewEnvClient()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer cli.Close()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(300)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(300)*time.Second)
 	defer cancel()
 
-	buildArgs := make(map[string]*string)
-
-	PWD, err := os.Getwd()
+	labels := ImageLabels(imageVersion(dir))
+	buildArgs, err := BuildArgs(dir)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer os.Chdir(PWD)
 
-	if err := os.Chdir(dir); err != nil {
-		return nil, err
+	opt := types.ImageBuildOptions{
+		Dockerfile: "./Dockerfile",
+		Tags:       []string{name},
+		NoCache:    *noCache,
+		Squash:     *squash,
+		Remove:     true,
+		BuildArgs:  buildArgs,
+		Labels:     labels,
+		Version:    builder,
+	}
+	applyBuildResources(&opt)
+	if *squash {
+		info, err := cli.Info(ctx)
+		if err != nil {
+			return err
+		}
+		if !info.ExperimentalBuild {
+			slog.Warn("--squash needs a docker daemon with experimental features enabled, the build may fail", "serverVersion", info.ServerVersion)
+		}
+	}
+	platform, ok := archPlatforms[filepath.Base(dir)]
+	if platformOverride != nil {
+		platform, ok = *platformOverride, true
+	}
+	if ok {
+		opt.Platform = platformString(platform)
+		if platform.Architecture != runtime.GOARCH {
+			if err := SetupQemuEmulation(ctx, cli); err != nil {
+				return err
+			}
+		}
+	}
+	if builder == types.BuilderBuildKit {
+		s, err := session.NewSession(ctx, "release", "")
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		go func() {
+			_ = s.Run(ctx, func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+				return cli.DialHijack(ctx, "/session", proto, meta)
+			})
+		}()
+		opt.SessionID = s.ID()
 	}
 
-	resp, err := cli.ImageBuild(
-		ctx,
-		dockerFileTarReader,
-		types.ImageBuildOptions{
-			Dockerfile: "./Dockerfile",
-			Tags:       []string{name},
-			NoCache:    true,
-			Remove:     true,
-			BuildArgs:  buildArgs,
-		})
+	resp, err := cli.ImageBuild(ctx, dockerFileTarReader, opt)
 
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	defer resp.Body.Close()
 
-	var messages []string
-
-	rd := bufio.NewReader(resp.Body)
-	for {
-		n, _, err := rd.ReadLine()
-		if err != nil && err == io.EOF {
-			break
-		} else if err != nil {
-			return messages, err
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		buildLog.WriteLine(scanner.Bytes())
+		var message struct {
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return fmt.Errorf("decode build output: %w", err)
+		}
+		if message.ErrorDetail.Message != "" {
+			return errors.New(message.ErrorDetail.Message)
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
 		}
-		messages = append(messages, string(n))
 	}
-
-	return messages, nil
+	return scanner.Err()
 }
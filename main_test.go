@@ -0,0 +1,498 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+func TestDownloadFile(t *testing.T) {
+	content := bytes.Repeat([]byte("openEuler"), 1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/image.tar.xz" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "image.tar.xz", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	t.Run("full", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "image.tar.xz")
+		if err := downloadFile(context.Background(), srv.URL+"/image.tar.xz", path); err != nil {
+			t.Fatalf("downloadFile: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("downloaded %d bytes, want %d", len(got), len(content))
+		}
+		if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+			t.Errorf("temp file left behind: %v", err)
+		}
+	})
+
+	t.Run("resume", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "image.tar.xz")
+		if err := os.WriteFile(path+".tmp", content[:1000], 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := downloadFile(context.Background(), srv.URL+"/image.tar.xz", path); err != nil {
+			t.Fatalf("downloadFile: %v", err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("resumed file differs from source: %d bytes, want %d", len(got), len(content))
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing.tar.xz")
+		err := downloadFile(context.Background(), srv.URL+"/missing.tar.xz", path)
+		var downloadErr *DownloadError
+		if !errors.As(err, &downloadErr) {
+			t.Fatalf("err = %v, want *DownloadError", err)
+		}
+		if downloadErr.Attempt != 1 {
+			t.Errorf("attempts = %d, want 1 for a 404", downloadErr.Attempt)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("file created for failed download: %v", err)
+		}
+	})
+}
+
+func TestFetchFile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "hello")
+	if err := fetchFile(context.Background(), srv.URL, path); err != nil {
+		t.Fatalf("fetchFile: %v", err)
+	}
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello" {
+		t.Errorf("content = %q, want %q", got, "hello")
+	}
+}
+
+func TestDownloaderCounts(t *testing.T) {
+	d := &Downloader{Reader: strings.NewReader("0123456789"), Total: 15, Current: 5}
+	buf := make([]byte, 4)
+	if _, err := d.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	if d.Current != 9 {
+		t.Errorf("Current = %d after 4 bytes from offset 5, want 9", d.Current)
+	}
+	var rest bytes.Buffer
+	if _, err := rest.ReadFrom(d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Current != d.Total {
+		t.Errorf("Current = %d at EOF, want Total %d", d.Current, d.Total)
+	}
+}
+
+func TestGetDockerHubTagPagination(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "", "1":
+			fmt.Fprintf(w, `{"next": %q, "results": [{"name": "22.03-lts"}, {"name": "latest"}]}`, srv.URL+"/tags?page=2")
+		case "2":
+			fmt.Fprint(w, `{"next": null, "results": [{"name": "22.03-lts-sp1"}, {"name": "24.03-lts"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	got, err := GetDockerHubTagFromURL(context.Background(), srv.URL+"/tags?page=1")
+	if err != nil {
+		t.Fatalf("GetDockerHubTagFromURL: %v", err)
+	}
+	want := []string{"22.03-lts", "22.03-lts-sp1", "24.03-lts"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+}
+
+func TestCreateTar(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"Dockerfile":              "FROM scratch\n",
+		"rootfs/etc/os-release":   "NAME=openEuler\n",
+		"rootfs/usr/bin/hello.sh": "#!/bin/sh\necho hello\n",
+	}
+	modes := map[string]os.FileMode{
+		"Dockerfile":              0644,
+		"rootfs/etc/os-release":   0644,
+		"rootfs/usr/bin/hello.sh": 0755,
+	}
+	for name, content := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), modes[name]); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, modes[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(src, "rootfs", "var", "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("hello.sh", filepath.Join(src, "rootfs", "usr", "bin", "hello")); err != nil {
+		t.Fatal(err)
+	}
+	tarFile := filepath.Join(t.TempDir(), "context.tar.gz")
+	if err := createTar(src, tarFile); err != nil {
+		t.Fatalf("createTar: %v", err)
+	}
+
+	f, err := os.Open(tarFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	got := map[string]string{}
+	headers := map[string]*tar.Header{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers[header.Name] = header
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[header.Name] = string(content)
+	}
+	if !reflect.DeepEqual(got, files) {
+		t.Errorf("tar contents = %v, want %v", got, files)
+	}
+	for name, mode := range modes {
+		if header := headers[name]; header != nil && os.FileMode(header.Mode).Perm() != mode {
+			t.Errorf("%s mode = %o, want %o", name, os.FileMode(header.Mode).Perm(), mode)
+		}
+	}
+	for _, name := range []string{"rootfs/", "rootfs/etc/", "rootfs/usr/bin/", "rootfs/var/empty/"} {
+		if header := headers[name]; header == nil || header.Typeflag != tar.TypeDir {
+			t.Errorf("%s: missing directory entry: %+v", name, header)
+		}
+	}
+	if header := headers["rootfs/usr/bin/hello"]; header == nil || header.Typeflag != tar.TypeSymlink || header.Linkname != "hello.sh" {
+		t.Errorf("rootfs/usr/bin/hello: want symlink to hello.sh, got %+v", header)
+	}
+}
+
+func TestCreateTarMissingSource(t *testing.T) {
+	tarFile := filepath.Join(t.TempDir(), "context.tar.gz")
+	if err := createTar(filepath.Join(t.TempDir(), "missing"), tarFile); err == nil {
+		t.Fatal("createTar succeeded for a missing source directory")
+	}
+	if _, err := os.Stat(tarFile); !os.IsNotExist(err) {
+		t.Errorf("partial tar left behind: %v", err)
+	}
+}
+
+func TestMatchTagProperty(t *testing.T) {
+	property := func(SourceTag, DestinationTag []string) bool {
+		destination := map[string]bool{}
+		for _, tag := range DestinationTag {
+			destination[NormalizeTag(tag)] = true
+		}
+		result := MatchTag(SourceTag, DestinationTag)
+		inResult := map[string]bool{}
+		for _, tag := range result {
+			if destination[NormalizeTag(tag)] {
+				return false
+			}
+			inResult[tag] = true
+		}
+		for _, tag := range SourceTag {
+			if !destination[NormalizeTag(tag)] && !inResult[tag] {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSha256encode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "image.tar.xz")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := sha256encode(path)
+	if err != nil {
+		t.Fatalf("sha256encode: %v", err)
+	}
+	sum := sha256.Sum256([]byte("hello\n"))
+	if want := hex.EncodeToString(sum[:]); got != want {
+		t.Errorf("sha256encode = %s, want %s", got, want)
+	}
+
+	if _, err := sha256encode(filepath.Join(t.TempDir(), "missing")); !os.IsNotExist(err) {
+		t.Errorf("err = %v for a missing file, want a not-exist error", err)
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	out, err := ExecCommand(t.TempDir(), "echo hello")
+	if err != nil {
+		t.Fatalf("ExecCommand(echo hello): %v", err)
+	}
+	if strings.TrimSpace(out) != "hello" {
+		t.Errorf("output = %q, want %q", out, "hello")
+	}
+
+	if _, err := ExecCommand(t.TempDir(), "exit 1"); err == nil {
+		t.Error("ExecCommand(exit 1) returned no error")
+	}
+}
+
+type fixtureTransport map[string]string
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path, ok := f[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(bytes.NewReader(content)),
+		Request:    req,
+	}, nil
+}
+
+func TestGetOpenEulerTag(t *testing.T) {
+	savedConfig, savedTransport := config, httpTransport
+	defer func() { config, httpTransport = savedConfig, savedTransport }()
+	config.ReleasesAPIURL = ""
+	config.SourceBaseURL = "https://repo.openeuler.org/"
+	config.ScrapeDelay = "0s"
+	httpTransport = fixtureTransport{
+		"https://repo.openeuler.org/": filepath.Join("testdata", "openeuler_index.html"),
+	}
+
+	got, err := GetOpenEulerTag(context.Background())
+	if err != nil {
+		t.Fatalf("GetOpenEulerTag: %v", err)
+	}
+	want := []string{"20.03-lts", "22.03-lts-sp1", "24.03-lts"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tags = %v, want %v", got, want)
+	}
+}
+
+func TestRetryPush(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"transient", errors.New(`"toomanyrequests: rate limit exceeded"`), 3},
+		{"unavailable", &HTTPStatusError{URL: "https://registry.example/v2/", StatusCode: http.StatusServiceUnavailable}, 3},
+		{"denied", errors.New(`"denied: requested access to the resource is denied"`), 1},
+		{"unauthorized", errors.New(`"unauthorized: authentication required"`), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := RetryPush(context.Background(), 3, 0, func() error {
+				calls++
+				return tt.err
+			})
+			if err != tt.err {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("push called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestDeleteUntrackedTagsSafety(t *testing.T) {
+	if _, err := DeleteUntrackedTags(context.Background(), []string{"20.03-lts", "22.03-lts"}, nil, false); err == nil {
+		t.Error("DeleteUntrackedTags accepted an empty upstream list")
+	}
+
+	saved := *maxDeleteTags
+	defer func() { *maxDeleteTags = saved }()
+	*maxDeleteTags = 1
+	hubTags := []string{"20.03-lts", "20.09", "21.03", "22.03-lts"}
+	if _, err := DeleteUntrackedTags(context.Background(), hubTags, []string{"22.03-lts"}, false); err == nil {
+		t.Error("DeleteUntrackedTags deleted more tags than --max-delete allows")
+	}
+}
+
+func TestCopyManifest(t *testing.T) {
+	type manifest struct{ mediaType, body string }
+	manifests := map[string]manifest{
+		"24.03-lts": {ociImageIndexMedia, `{"schemaVersion":2,"manifests":[]}`},
+	}
+	puts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reference := strings.TrimPrefix(r.URL.Path, "/v2/openeuler/openeuler/manifests/")
+		switch r.Method {
+		case http.MethodGet:
+			m, ok := manifests[reference]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			sum := sha256.Sum256([]byte(m.body))
+			w.Header().Set("Content-Type", m.mediaType)
+			w.Header().Set("Docker-Content-Digest", "sha256:"+hex.EncodeToString(sum[:]))
+			io.WriteString(w, m.body)
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			manifests[reference] = manifest{r.Header.Get("Content-Type"), string(body)}
+			puts++
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	saved := config
+	defer func() { config = saved }()
+	config.RegistryType = "oci"
+	config.RegistryURL = srv.URL
+	config.TargetRepository = "openeuler/openeuler"
+	registry := &GenericOCIRegistryClient{BaseURL: srv.URL, Repository: config.TargetRepository}
+
+	for i := 0; i < 2; i++ {
+		if err := CopyManifest(context.Background(), registry, "24.03-lts", "latest"); err != nil {
+			t.Fatalf("CopyManifest: %v", err)
+		}
+	}
+	if manifests["latest"] != manifests["24.03-lts"] {
+		t.Errorf("latest = %+v, want %+v", manifests["latest"], manifests["24.03-lts"])
+	}
+	if puts != 1 {
+		t.Errorf("manifest pushed %d times, want 1 when the alias is already current", puts)
+	}
+	if err := CopyManifest(context.Background(), registry, "missing", "latest"); err == nil {
+		t.Error("CopyManifest succeeded for a missing source tag")
+	}
+}
+
+func TestGenerateReleaseNotes(t *testing.T) {
+	savedArchs := config.Architectures
+	defer func() {
+		config.Architectures = savedArchs
+		report = RunReport{}
+	}()
+	config.Architectures = []string{"x86_64", "aarch64"}
+	report = RunReport{}
+	report.RecordPush("24.03-lts", "x86_64", "openeuler/openeuler:24.03-lts-x86_64", "sha256:aaa")
+
+	notes := GenerateReleaseNotes([]string{"22.03-lts", "24.03-lts"}, time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC))
+	for _, want := range []string{"## 24.03-lts", "docker pull openeuler/openeuler:24.03-lts-x86_64", "| x86_64 | `openeuler/openeuler:24.03-lts-x86_64` | `sha256:aaa` |"} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("notes missing %q:\n%s", want, notes)
+		}
+	}
+	for _, unwanted := range []string{"22.03-lts", "aarch64"} {
+		if strings.Contains(notes, unwanted) {
+			t.Errorf("notes mention %q, which was not pushed:\n%s", unwanted, notes)
+		}
+	}
+}
+
+func TestCleanupPushed(t *testing.T) {
+	workDir := t.TempDir()
+	for _, arch := range []string{"x86_64", "aarch64"} {
+		if err := os.MkdirAll(filepath.Join(workDir, "openEuler", "22.03-lts", arch), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	markPushed("22.03-lts", "x86_64")
+	if err := CleanupPushed(workDir); err != nil {
+		t.Fatalf("CleanupPushed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "openEuler", "22.03-lts", "x86_64")); !os.IsNotExist(err) {
+		t.Errorf("pushed arch directory kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "openEuler", "22.03-lts", "aarch64")); err != nil {
+		t.Errorf("unpushed arch directory removed: %v", err)
+	}
+	if len(pushed.archs) != 0 {
+		t.Errorf("pushed entries left after cleanup: %v", pushed.archs)
+	}
+}
+
+func TestRecordPushedTag(t *testing.T) {
+	savedStateFile := config.StateFile
+	defer func() { config.StateFile = savedStateFile }()
+	config.StateFile = filepath.Join(t.TempDir(), "state.json")
+	updated := time.Date(2024, 6, 6, 0, 0, 0, 0, time.UTC)
+	if err := (StateFile{PushedTags: []string{"22.03-lts"}, UpdatedAt: updated}).Save(config.StateFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tag := range []string{"24.03-lts", "24.03-lts"} {
+		if err := RecordPushedTag(tag); err != nil {
+			t.Fatalf("RecordPushedTag(%q): %v", tag, err)
+		}
+	}
+	state, err := LoadState(config.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"22.03-lts", "24.03-lts"}; !reflect.DeepEqual(state.PushedTags, want) {
+		t.Errorf("PushedTags = %v, want %v", state.PushedTags, want)
+	}
+	if !state.UpdatedAt.Equal(updated) {
+		t.Errorf("UpdatedAt = %v, want %v", state.UpdatedAt, updated)
+	}
+}